@@ -0,0 +1,509 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"porte/types"
+	"porte/utils"
+
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Skip      SkipConfig      `yaml:"skip"`
+	Other     OtherConfig     `yaml:"other"`
+	Dates     DatesConfig     `yaml:"dates"`
+	Metadata  MetadataConfig  `yaml:"metadata"`
+	Flags     FlagsConfig     `yaml:"flags"`
+	Geo       GeoConfig       `yaml:"geo"`
+	Sidecar   SidecarConfig   `yaml:"sidecar"`
+	Transcode TranscodeConfig `yaml:"transcode"`
+}
+
+// Rules for choosing and writing each file's capture date.
+type DatesConfig struct {
+	// Date sources in order of preference. The first source with a date wins; if
+	// a source matches several dates, the earliest wins. Sources are:
+	// - "exif:<TagName>", like "exif:DateTimeOriginal", for a tag in the file
+	// - "exif:*", for any tag in the file not listed elsewhere
+	// - "json:<field>", like "json:photoTakenTime", for a Google Photos json field
+	// - "filename", for a date in the file name or image title
+	// - "folder", for a year or month in the name of a containing folder, like
+	//   "Photos from 2014" or "2009-07 Lisbon trip"
+	// Dates from unlisted sources are never used.
+	Priority []string `yaml:"priority"`
+
+	// Resolve the local time zone from the file's coordinates, and use it to write
+	// local dates with offsets and to name files by local time.
+	InferTimeZone bool `yaml:"inferTimeZone"`
+
+	// Languages to search file names and titles for dates in, like "en" or "fr".
+	Languages []string `yaml:"languages"`
+
+	// Add the languages of localized Google Takeout folder names, like "Fotos von
+	// 2014", to Languages.
+	DetectLanguages bool `yaml:"detectLanguages"`
+
+	// Copy files dated by a folder name to a `review` directory, instead of the
+	// success directory, since their dates are only accurate to the month or year.
+	ReviewFolderDates bool `yaml:"reviewFolderDates"`
+
+	// Estimate the date of a file without one from the dated files next to it in
+	// its sequence, like IMG_0411 and IMG_0413 for IMG_0412, instead of failing it.
+	InferFromNeighbors bool `yaml:"inferFromNeighbors"`
+
+	// The furthest apart in sequence number a neighbor can be to be used for an
+	// estimate.
+	MaxNeighborGap int `yaml:"maxNeighborGap"`
+
+	// Rules rejecting dates that can't be a real capture date.
+	Plausibility PlausibilityConfig `yaml:"plausibility"`
+}
+
+// Rules for rejecting implausible dates, like the defaults written by devices whose
+// clock wasn't set. Rejected dates are never used.
+type PlausibilityConfig struct {
+	// Reject dates before January 1 of this year. Zero disables the rule.
+	MinYear int `yaml:"minYear"`
+
+	// Reject dates after the time of the run.
+	RejectFuture bool `yaml:"rejectFuture"`
+
+	// Wall-clock dates in SentinelDateFmt, like "2000-01-01 00:00:00", that devices
+	// are known to write by default. A date matches if either its local or UTC
+	// wall-clock time is equal.
+	Sentinels []string `yaml:"sentinels"`
+
+	// Reject dates before the release of the device named in the file's Model tag.
+	RejectBeforeDeviceRelease bool `yaml:"rejectBeforeDeviceRelease"`
+
+	// Release dates of devices by Model tag, in addition to the built-in list.
+	DeviceReleaseDates map[string]time.Time `yaml:"deviceReleaseDates"`
+
+	// Reject dates from GPS tags, like GPSDateStamp and GPSDateTime, which record
+	// the UTC time of the last satellite fix, often to the day only, rather than
+	// when the file was captured.
+	RejectGPSDates bool `yaml:"rejectGPSDates"`
+}
+
+const SentinelDateFmt = "2006-01-02 15:04:05"
+
+// Rules for leaving files out of the export. A file matching any rule is logged
+// with the skip outcome and is not copied to the destination directory.
+type SkipConfig struct {
+	// Glob patterns (see filepath.Match). A pattern containing a slash is matched
+	// against the path relative to the source directory; otherwise it is matched
+	// against the file name. If any include patterns are set, files that
+	// match none of them are skipped.
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+
+	// File size bounds in bytes. Zero disables the bound.
+	MinSizeBytes int64 `yaml:"minSizeBytes"`
+	MaxSizeBytes int64 `yaml:"maxSizeBytes"`
+
+	// If set, files of any other media kind are skipped.
+	MediaKinds []types.MediaKind `yaml:"mediaKinds"`
+
+	// Capture date bounds. A zero value disables the bound.
+	CapturedAfter  time.Time `yaml:"capturedAfter"`
+	CapturedBefore time.Time `yaml:"capturedBefore"`
+
+	// Named classes of files, like "screenshots".
+	Classes []SkipClass `yaml:"classes"`
+}
+
+// Handling for files that aren't images, videos, or their metadata.
+type OtherConfig struct {
+	// Copy unsupported files to an `other` directory in the destination.
+	CopyUnsupported bool `yaml:"copyUnsupported"`
+}
+
+// Rules for carrying Google Photos metadata, like captions, into each file.
+type MetadataConfig struct {
+	// How to combine a Google Photos description with one already in the file.
+	DescriptionPolicy DescriptionPolicy `yaml:"descriptionPolicy"`
+}
+
+// Handling for files favorited, archived, or trashed in Google Photos, so the export
+// matches what's shown there.
+type FlagsConfig struct {
+	// The XMP rating given to favorites, from 1 to 5. Zero disables the rating.
+	FavoriteRating int `yaml:"favoriteRating"`
+	// The XMP label given to favorites, like "Red". Empty disables the label.
+	FavoriteLabel string `yaml:"favoriteLabel"`
+
+	Archived FlagAction `yaml:"archived"`
+	Trashed  FlagAction `yaml:"trashed"`
+}
+
+type FlagAction = string
+
+const (
+	// Export the file like any other.
+	FlagActionKeep FlagAction = "keep"
+	// Add the flag's name as a keyword.
+	FlagActionTag FlagAction = "tag"
+	// Export the file to a subdirectory named for the flag.
+	FlagActionSubfolder FlagAction = "subfolder"
+	// Leave the file out, with the skip outcome.
+	FlagActionSkip FlagAction = "skip"
+)
+
+var flagActions = []FlagAction{
+	FlagActionKeep,
+	FlagActionTag,
+	FlagActionSubfolder,
+	FlagActionSkip,
+}
+
+// Rules for choosing each file's location.
+type GeoConfig struct {
+	// Location sources in order of preference. The first source with a location
+	// wins. Sources are:
+	// - "exif", for the GPS tags in the file
+	// - "json:geoData", for the Google Photos location, including any edits
+	// - "json:geoDataExif", for Google Photos' record of the location in the file
+	//   when it was uploaded
+	// Locations from unlisted sources are never used.
+	Priority []string `yaml:"priority"`
+
+	// Record a conflict for any location found further than this many kilometers
+	// from the one used.
+	ConflictThresholdKm float64 `yaml:"conflictThresholdKm"`
+}
+
+const (
+	GeoSrcExif            = "exif"
+	GeoSrcJSONGeoData     = DateSrcJSONPrefix + "geoData"
+	GeoSrcJSONGeoDataExif = DateSrcJSONPrefix + "geoDataExif"
+)
+
+var geoSrcs = []string{
+	GeoSrcExif,
+	GeoSrcJSONGeoData,
+	GeoSrcJSONGeoDataExif,
+}
+
+// Rules for writing tags to an XMP sidecar file next to each exported file, which
+// is then left byte-identical to the original.
+type SidecarConfig struct {
+	// When to write a sidecar instead of writing tags into the file.
+	Mode SidecarMode `yaml:"mode"`
+
+	// Extensions of files that can't be safely written in place, like ".avi", which
+	// always get a sidecar unless Mode is "never".
+	Extensions []string `yaml:"extensions"`
+
+	// Write a sidecar for camera RAW files, like ".cr2", unless Mode is "never",
+	// since writing into them risks corrupting their maker notes.
+	Raw bool `yaml:"raw"`
+
+	// How sidecars are named. A RAW file whose paired image already has a Lightroom
+	// sidecar gets a darktable one instead, since both would share a name.
+	Naming SidecarNaming `yaml:"naming"`
+}
+
+// Rules for re-encoding videos that can't be repackaged in an mp4 container without
+// re-encoding, like 3GP H.263, WMV, MJPEG AVI, or MPEG-1, as H.264 and AAC in mp4.
+type TranscodeConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// The x264 constant rate factor, from 0 (lossless) to 51. Lower is higher
+	// quality and larger.
+	CRF int `yaml:"crf"`
+
+	// The x264 preset, like "medium". Slower presets are smaller at the same quality.
+	Preset string `yaml:"preset"`
+
+	// Save the original next to the transcode, under the same name, instead of
+	// replacing it.
+	KeepOriginal bool `yaml:"keepOriginal"`
+}
+
+// The x264 presets, from fastest to slowest.
+var TranscodePresets = []string{
+	"ultrafast",
+	"superfast",
+	"veryfast",
+	"faster",
+	"fast",
+	"medium",
+	"slow",
+	"slower",
+	"veryslow",
+}
+
+type SidecarMode = string
+
+const (
+	// Write tags into every file, failing files where that fails.
+	SidecarModeNever SidecarMode = "never"
+	// Write a sidecar for files with a listed extension, or where writing tags into
+	// the file fails.
+	SidecarModeFallback SidecarMode = "fallback"
+	// Write a sidecar for every file.
+	SidecarModeAlways SidecarMode = "always"
+)
+
+var sidecarModes = []SidecarMode{
+	SidecarModeNever,
+	SidecarModeFallback,
+	SidecarModeAlways,
+}
+
+type SidecarNaming = string
+
+const (
+	// The full file name plus ".xmp", like "IMG_0001.jpg.xmp", as darktable names
+	// sidecars.
+	SidecarNamingDarktable SidecarNaming = "darktable"
+	// The file name with ".xmp" in place of its extension, like "IMG_0001.xmp", as
+	// Lightroom names sidecars.
+	SidecarNamingLightroom SidecarNaming = "lightroom"
+)
+
+var sidecarNamings = []SidecarNaming{
+	SidecarNamingDarktable,
+	SidecarNamingLightroom,
+}
+
+type DescriptionPolicy = string
+
+const (
+	// Use the Google Photos description, if any.
+	DescriptionPolicyPreferJSON DescriptionPolicy = "preferJSON"
+	// Keep the file's description, if any.
+	DescriptionPolicyPreferEmbedded DescriptionPolicy = "preferEmbedded"
+	// Keep both, the file's description first, unless one contains the other.
+	DescriptionPolicyAppend DescriptionPolicy = "append"
+)
+
+var descriptionPolicies = []DescriptionPolicy{
+	DescriptionPolicyPreferJSON,
+	DescriptionPolicyPreferEmbedded,
+	DescriptionPolicyAppend,
+}
+
+const (
+	DateSrcFileName   = "filename"
+	DateSrcFolder     = "folder"
+	DateSrcExifPrefix = "exif:"
+	DateSrcExifAny    = DateSrcExifPrefix + "*"
+	DateSrcJSONPrefix = "json:"
+)
+
+// The Google Photos json fields that contain dates.
+var jsonDateFields = []string{
+	"photoTakenTime",
+	"creationTime",
+	"photoLastModifiedTime",
+}
+
+type SkipClass = string
+
+const (
+	SkipClassScreenshots SkipClass = "screenshots"
+)
+
+var skipClasses = []SkipClass{
+	SkipClassScreenshots,
+}
+
+// Returns the configuration used when no config file is provided.
+func Default() Config {
+	return Config{
+		Dates: DatesConfig{
+			Priority: []string{
+				DateSrcJSONPrefix + "photoTakenTime",
+				DateSrcExifPrefix + "DateTimeOriginal",
+				DateSrcExifPrefix + "CreateDate",
+				DateSrcExifAny,
+				DateSrcFileName,
+				DateSrcJSONPrefix + "creationTime",
+				DateSrcFolder,
+			},
+			InferTimeZone:   true,
+			Languages:       []string{"en"},
+			DetectLanguages: true,
+			MaxNeighborGap:  10,
+			Plausibility: PlausibilityConfig{
+				MinYear:      1900,
+				RejectFuture: true,
+				Sentinels: []string{
+					// The QuickTime, Unix, and FAT epochs, and a common camera default.
+					"1904-01-01 00:00:00",
+					"1970-01-01 00:00:00",
+					"1980-01-01 00:00:00",
+					"2000-01-01 00:00:00",
+				},
+				RejectBeforeDeviceRelease: true,
+				RejectGPSDates:            true,
+			},
+		},
+		Metadata: MetadataConfig{
+			DescriptionPolicy: DescriptionPolicyAppend,
+		},
+		Flags: FlagsConfig{
+			FavoriteRating: 5,
+			Archived:       FlagActionTag,
+			Trashed:        FlagActionSkip,
+		},
+		Geo: GeoConfig{
+			Priority: []string{
+				GeoSrcJSONGeoData,
+				GeoSrcExif,
+				GeoSrcJSONGeoDataExif,
+			},
+			ConflictThresholdKm: 1,
+		},
+		Sidecar: SidecarConfig{
+			Mode:       SidecarModeFallback,
+			Extensions: []string{".avi", ".mkv"},
+			Raw:        true,
+			Naming:     SidecarNamingDarktable,
+		},
+		Transcode: TranscodeConfig{
+			CRF:          23,
+			Preset:       "medium",
+			KeepOriginal: true,
+		},
+	}
+}
+
+// Reads the yaml config file at path, with any unset values taken from the
+// defaults. An empty path returns the defaults.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	bt, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = yaml.Unmarshal(bt, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file '%s': %s", path, err)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config file '%s': %s", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Returns an error describing the first invalid value in cfg, if any.
+func (cfg Config) Validate() error {
+	for _, p := range append(cfg.Skip.Include, cfg.Skip.Exclude...) {
+		_, err := filepath.Match(p, "")
+		if err != nil {
+			return fmt.Errorf("invalid skip pattern '%s': %s", p, err)
+		}
+	}
+
+	for _, k := range cfg.Skip.MediaKinds {
+		if k != types.Image && k != types.Video {
+			return fmt.Errorf("unknown skip media kind '%s'", k)
+		}
+	}
+
+	for _, c := range cfg.Skip.Classes {
+		if !slices.Contains(skipClasses, c) {
+			return fmt.Errorf("unknown skip class '%s'", c)
+		}
+	}
+
+	if len(cfg.Dates.Priority) == 0 {
+		return fmt.Errorf("dates priority is empty")
+	}
+	for _, src := range cfg.Dates.Priority {
+		if src == DateSrcFileName || src == DateSrcFolder {
+			continue
+		}
+		if strings.HasPrefix(src, DateSrcExifPrefix) && len(src) > len(DateSrcExifPrefix) {
+			continue
+		}
+		if strings.HasPrefix(src, DateSrcJSONPrefix) && slices.Contains(jsonDateFields, strings.TrimPrefix(src, DateSrcJSONPrefix)) {
+			continue
+		}
+		return fmt.Errorf("unknown date source '%s'", src)
+	}
+
+	if len(cfg.Dates.Languages) == 0 && !cfg.Dates.DetectLanguages {
+		return fmt.Errorf("dates languages is empty")
+	}
+	for _, lang := range cfg.Dates.Languages {
+		if !utils.IsDateLanguage(lang) {
+			return fmt.Errorf("unknown date language '%s'", lang)
+		}
+	}
+
+	if cfg.Dates.InferFromNeighbors && cfg.Dates.MaxNeighborGap < 1 {
+		return fmt.Errorf("dates maxNeighborGap must be at least 1")
+	}
+
+	for _, d := range cfg.Dates.Plausibility.Sentinels {
+		_, err := time.Parse(SentinelDateFmt, d)
+		if err != nil {
+			return fmt.Errorf("invalid sentinel date '%s', expected the format '%s'", d, SentinelDateFmt)
+		}
+	}
+
+	if !slices.Contains(descriptionPolicies, cfg.Metadata.DescriptionPolicy) {
+		return fmt.Errorf("unknown metadata descriptionPolicy '%s'", cfg.Metadata.DescriptionPolicy)
+	}
+
+	if cfg.Flags.FavoriteRating < 0 || cfg.Flags.FavoriteRating > 5 {
+		return fmt.Errorf("flags favoriteRating must be from 0 to 5")
+	}
+	if !slices.Contains(flagActions, cfg.Flags.Archived) {
+		return fmt.Errorf("unknown flags archived action '%s'", cfg.Flags.Archived)
+	}
+	if !slices.Contains(flagActions, cfg.Flags.Trashed) {
+		return fmt.Errorf("unknown flags trashed action '%s'", cfg.Flags.Trashed)
+	}
+
+	for _, src := range cfg.Geo.Priority {
+		if !slices.Contains(geoSrcs, src) {
+			return fmt.Errorf("unknown geo source '%s'", src)
+		}
+	}
+	if cfg.Geo.ConflictThresholdKm < 0 {
+		return fmt.Errorf("geo conflictThresholdKm must not be negative")
+	}
+
+	if !slices.Contains(sidecarModes, cfg.Sidecar.Mode) {
+		return fmt.Errorf("unknown sidecar mode '%s'", cfg.Sidecar.Mode)
+	}
+	if !slices.Contains(sidecarNamings, cfg.Sidecar.Naming) {
+		return fmt.Errorf("unknown sidecar naming '%s'", cfg.Sidecar.Naming)
+	}
+	for _, ext := range cfg.Sidecar.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("sidecar extension '%s' must start with '.'", ext)
+		}
+	}
+
+	if cfg.Transcode.CRF < 0 || cfg.Transcode.CRF > 51 {
+		return fmt.Errorf("transcode crf must be from 0 to 51")
+	}
+	if !slices.Contains(TranscodePresets, cfg.Transcode.Preset) {
+		return fmt.Errorf("unknown transcode preset '%s'", cfg.Transcode.Preset)
+	}
+
+	if cfg.Skip.MaxSizeBytes > 0 && cfg.Skip.MinSizeBytes > cfg.Skip.MaxSizeBytes {
+		return fmt.Errorf("skip minSizeBytes is larger than maxSizeBytes")
+	}
+
+	return nil
+}
@@ -19,8 +19,11 @@ const (
 	PhaseCounting       phase = 0
 	PhaseAnalyzing      phase = 1
 	PhaseConvertingImgs phase = 2
-	PhaseConvertingVids phase = 3
-	PhaseComplete       phase = 4
+	PhaseConvertingRaws phase = 3
+	PhaseConvertingVids phase = 4
+	PhaseInferringDates phase = 5
+	PhaseHandlingOther  phase = 6
+	PhaseComplete       phase = 7
 )
 
 const (
@@ -75,8 +78,14 @@ func Update(phase int, entry [][]string) {
 		output[PhaseAnalyzing] = entry
 	} else if phase == PhaseConvertingImgs {
 		output[PhaseConvertingImgs] = entry
+	} else if phase == PhaseConvertingRaws {
+		output[PhaseConvertingRaws] = entry
 	} else if phase == PhaseConvertingVids {
 		output[PhaseConvertingVids] = entry
+	} else if phase == PhaseInferringDates {
+		output[PhaseInferringDates] = entry
+	} else if phase == PhaseHandlingOther {
+		output[PhaseHandlingOther] = entry
 	} else if phase == PhaseComplete {
 		output[PhaseComplete] = entry
 		retreat = false
@@ -101,8 +110,14 @@ func print(phase int, retreat bool) {
 	rows = append(rows, output[PhaseAnalyzing]...)
 	rows = append(rows, []string{checkIfCompleted(PhaseConvertingImgs), "Converting images"})
 	rows = append(rows, output[PhaseConvertingImgs]...)
+	rows = append(rows, []string{checkIfCompleted(PhaseConvertingRaws), "Converting RAW images"})
+	rows = append(rows, output[PhaseConvertingRaws]...)
 	rows = append(rows, []string{checkIfCompleted(PhaseConvertingVids), "Converting videos"})
 	rows = append(rows, output[PhaseConvertingVids]...)
+	rows = append(rows, []string{checkIfCompleted(PhaseInferringDates), "Inferring dates"})
+	rows = append(rows, output[PhaseInferringDates]...)
+	rows = append(rows, []string{checkIfCompleted(PhaseHandlingOther), "Handling other files"})
+	rows = append(rows, output[PhaseHandlingOther]...)
 	rows = append(rows, []string{checkIfCompleted(PhaseComplete), "Complete"})
 	rows = append(rows, output[PhaseComplete]...)
 
@@ -1,13 +1,14 @@
 package encode
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"porte/lib"
 	"porte/types"
@@ -15,116 +16,476 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-func CopyVideo(fileInfo types.FileInfo, srcPath string, tmpDir string, fileNameNoExt string) (destPath string, err error) {
+// Container formats a video can be losslessly repackaged in, by ffmpeg format name.
+const (
+	remuxFormatMP4 = "mp4"
+	remuxFormatMOV = "mov"
+	remuxFormatMKV = "matroska"
+)
+
+var remuxFormatExts = map[string]string{
+	remuxFormatMP4: ".mp4",
+	remuxFormatMOV: ".mov",
+	remuxFormatMKV: ".mkv",
+}
+
+// Extensions of legacy containers whose metadata can't be written, like AVI, which
+// are repackaged in a writable container even if their codecs aren't supported in
+// mp4.
+var legacyVidExts = []string{
+	".avi",
+	".wmv",
+	".asf",
+	".flv",
+	".mpg",
+	".mpeg",
+	".vob",
+}
+
+// Codecs supported in a mov container, beyond those supported in mp4, such as the
+// motion jpeg and pcm audio written by many older cameras.
+var movVidCodecs = []string{
+	"mjpeg",
+	"mpeg4",
+	"h264",
+	"mpeg2video",
+	"dvvideo",
+	"rawvideo",
+}
+var movAudCodecs = []string{
+	"pcm_u8",
+	"pcm_s16le",
+	"pcm_s16be",
+	"pcm_s24le",
+	"adpcm_ima_qt",
+	"pcm_mulaw",
+	"pcm_alaw",
+	"aac",
+	"mp3",
+	"alac",
+}
+
+// Stream types, as named by ffprobe.
+const (
+	streamVideo    = "video"
+	streamAudio    = "audio"
+	streamSubtitle = "subtitle"
+	streamData     = "data"
+)
+
+// The bitrate of audio transcoded to AAC.
+const aacBitrate = "192k"
+
+// Video codecs that can be copied into an mp4 container.
+var mp4VidCodecs = []string{
+	// "mpeg1video", // Disabled due to an error opening the result in QuickTime.
+	"mpeg2video",
+	"mpeg4",
+	"h264",
+	"hevc",
+	"av1",
+}
+
+// Audio codecs that can be copied into an mp4 container. Any other audio, like pcm
+// or amr, is transcoded to AAC.
+var mp4AudCodecs = []string{
+	"aac",
+	"mp1",
+	"mp2",
+	"mp3",
+	"ac3",
+	"eac3",
+	"opus",
+	"alac",
+	"vorbis",
+	"qcelp",
+	"twinvq",
+}
+
+// Text subtitle codecs, which are converted to mov_text, the only subtitle codec
+// supported in mp4. Bitmap subtitles, like dvd_subtitle, are dropped.
+var textSubCodecs = []string{
+	"subrip",
+	"srt",
+	"ass",
+	"ssa",
+	"webvtt",
+	"text",
+}
+
+// Returns how each of streams is handled when repackaging in an mp4 container.
+func getStreamDecisions(streams []types.VidStream) []types.StreamDecision {
+	decisions := []types.StreamDecision{}
+
+	for _, s := range streams {
+		d := types.StreamDecision{Index: s.Index, Stream: s.Type, Codec: s.Codec}
+		switch s.Type {
+		case streamVideo:
+			if s.IsAttachedPic {
+				d.Action = types.StreamActionDrop
+				d.Reason = "cover art"
+			} else if s.Codec == "hevc" {
+				d.Action = types.StreamActionCopyHvc1
+				d.Reason = "supported in mp4, tagged hvc1 for Apple players"
+			} else if slices.Contains(mp4VidCodecs, s.Codec) {
+				d.Action = types.StreamActionCopy
+				d.Reason = "supported in mp4"
+			} else {
+				d.Action = types.StreamActionUnsupported
+				d.Reason = "not supported in mp4 without re-encoding"
+			}
+		case streamAudio:
+			if slices.Contains(mp4AudCodecs, s.Codec) {
+				d.Action = types.StreamActionCopy
+				d.Reason = "supported in mp4"
+			} else {
+				d.Action = types.StreamActionTranscode
+				d.Reason = "not supported in mp4, transcoded to AAC"
+			}
+		case streamSubtitle:
+			if s.Codec == "mov_text" {
+				d.Action = types.StreamActionCopy
+				d.Reason = "supported in mp4"
+			} else if slices.Contains(textSubCodecs, s.Codec) {
+				d.Action = types.StreamActionTranscode
+				d.Reason = "not supported in mp4, converted to mov_text"
+			} else {
+				d.Action = types.StreamActionDrop
+				d.Reason = "bitmap subtitles aren't supported in mp4"
+			}
+		default:
+			// Data streams, like timecodes and camera telemetry, aren't carried over by
+			// ffmpeg by default either.
+			d.Action = types.StreamActionDrop
+			d.Reason = "not a video, audio, or subtitle stream"
+		}
+		decisions = append(decisions, d)
+	}
+
+	return decisions
+}
+
+// Returns the ffmpeg arguments for mapping each stream kept by decisions to the
+// output and handling it as decided.
+func getStreamArgs(decisions []types.StreamDecision) []string {
+	args := []string{}
+	outIdx := 0
+	for _, d := range decisions {
+		if d.Action == types.StreamActionDrop || d.Action == types.StreamActionUnsupported {
+			continue
+		}
+
+		args = append(args, "-map", fmt.Sprintf("0:%d", d.Index))
+		spec := strconv.Itoa(outIdx)
+		switch {
+		case d.Action == types.StreamActionCopyHvc1:
+			args = append(args, "-c:"+spec, "copy", "-tag:"+spec, "hvc1")
+		case d.Action == types.StreamActionTranscode && d.Stream == streamAudio:
+			args = append(args, "-c:"+spec, "aac", "-b:"+spec, aacBitrate)
+		case d.Action == types.StreamActionTranscode && d.Stream == streamSubtitle:
+			args = append(args, "-c:"+spec, "mov_text")
+		default:
+			args = append(args, "-c:"+spec, "copy")
+		}
+		outIdx++
+	}
+
+	return args
+}
+
+// Returns decisions, made for an mp4 container, adjusted for repackaging in format.
+// A mov or mkv container is only chosen if it supports every video and audio
+// stream, so they're all copied. Subtitles are handled as for mp4 in mov, while mkv
+// takes every subtitle as is.
+func getRemuxDecisions(decisions []types.StreamDecision, format string) []types.StreamDecision {
+	if format == remuxFormatMP4 {
+		return decisions
+	}
+
+	adjusted := []types.StreamDecision{}
+	for _, d := range decisions {
+		isVidOrAud := d.Stream == streamVideo || d.Stream == streamAudio
+		if isVidOrAud && (d.Action == types.StreamActionUnsupported || d.Action == types.StreamActionTranscode) {
+			d.Action = types.StreamActionCopy
+			d.Reason = fmt.Sprintf("supported in %s", format)
+		} else if format == remuxFormatMKV && d.Action == types.StreamActionCopyHvc1 {
+			d.Action = types.StreamActionCopy
+		} else if format == remuxFormatMKV && d.Stream == streamSubtitle {
+			d.Action = types.StreamActionCopy
+			d.Reason = fmt.Sprintf("supported in %s", format)
+		}
+		adjusted = append(adjusted, d)
+	}
+
+	return adjusted
+}
+
+// Metadata written while repackaging a video, so that it's readable by players even
+// in containers whose tags can't be edited afterward, like mkv.
+type VidMetadata struct {
+	Title string
+	Date  time.Time
+}
+
+// Returns the ffmpeg arguments for writing meta.
+func getMetadataArgs(meta VidMetadata) []string {
+	args := []string{}
+	if meta.Title != "" {
+		args = append(args, "-metadata", fmt.Sprintf("title=%s", meta.Title))
+	}
+	if !meta.Date.IsZero() {
+		args = append(args, "-metadata", fmt.Sprintf("creation_time=%s", meta.Date.UTC().Format(time.RFC3339)))
+	}
+	return args
+}
+
+// Duplicates the video at srcPath into tmpDir, repackaging its streams without
+// re-encoding in an mp4 container if possible. A legacy container, like avi, is
+// repackaged in a mov or else an mkv container if its codecs allow. If every
+// repackaging fails, the file is copied as is, and the errors are returned in
+// remuxErrs.
+func CopyVideo(fileInfo types.FileInfo, srcPath string, tmpDir string, fileNameNoExt string, meta VidMetadata) (destPath string, remuxErrs []error, err error) {
 	if fileInfo.MediaKind != types.Video {
-		return "", errors.New("file is not a video")
+		return "", nil, errors.New("file is not a video")
 	}
 
-	// Repackage the video and audio in an mp4 container if possible, or just
-	// duplicate the file.
+	// Repackage the video and audio in the first container that supports them.
 
-	var cmd *exec.Cmd
-	if fileInfo.VidInfo.CanBeRePackagedInMP4 {
-		destPath = filepath.Join(tmpDir, fileNameNoExt) + ".mp4"
+	ext := strings.ToLower(filepath.Ext(fileInfo.Name))
+	for _, format := range getRemuxFormats(fileInfo.VidInfo, ext) {
+		destPath = filepath.Join(tmpDir, fileNameNoExt) + remuxFormatExts[format]
 		cmdArgs := []string{
+			"-y",
 			"-i", srcPath,
-			"-f", "mp4",
-			"-c:v", "copy",
-			"-c:a", "copy",
-			destPath,
+			"-f", format,
 		}
-		cmd = exec.Command(lib.FfmpegBin, cmdArgs...)
-	} else {
-		ext := filepath.Ext(fileInfo.Name)
-		destPath = filepath.Join(tmpDir, fileNameNoExt) + ext
-		cmd = exec.Command("cp", srcPath, destPath)
+		cmdArgs = append(cmdArgs, getStreamArgs(getRemuxDecisions(fileInfo.VidInfo.StreamDecisions, format))...)
+		cmdArgs = append(cmdArgs, getMetadataArgs(meta)...)
+		cmdArgs = append(cmdArgs, destPath)
+
+		out, err := exec.Command(lib.FfmpegBin, cmdArgs...).CombinedOutput()
+		if err == nil {
+			return destPath, remuxErrs, nil
+		}
+		remuxErrs = append(remuxErrs, fmt.Errorf("error repackaging as %s: %s, %s", format, err, string(out)))
 	}
 
-	out, err := cmd.CombinedOutput()
+	// Otherwise, just duplicate the file.
+
+	destPath = filepath.Join(tmpDir, fileNameNoExt) + filepath.Ext(fileInfo.Name)
+	out, err := exec.Command("cp", srcPath, destPath).CombinedOutput()
 	if err != nil {
-		return "", errors.Join(err, fmt.Errorf(string(out)))
+		return "", remuxErrs, errors.Join(err, fmt.Errorf(string(out)))
 	}
 
-	return destPath, nil
+	return destPath, remuxErrs, nil
 }
 
-// Returns the codecs used to encode the video at srcPath and whether they are
-// supported in an mp4 container, as well as the duration.
-func GetVidInfo(srcPath string) (vidInfo types.VidInfo, err error) {
-	vidInfo = types.VidInfo{}
+// Returns the containers, as ffmpeg format names, that the video described by
+// vidInfo can be repackaged in without re-encoding, in order of preference. A
+// video in a container other than a legacy one, identified by ext, is only
+// repackaged in mp4.
+func getRemuxFormats(vidInfo types.VidInfo, ext string) []string {
+	formats := []string{}
+	if vidInfo.CanBeRePackagedInMP4 {
+		formats = append(formats, remuxFormatMP4)
+	}
+	if !slices.Contains(legacyVidExts, ext) || vidInfo.VidCodec == "" {
+		return formats
+	}
+
+	if isMovCompat(vidInfo) {
+		formats = append(formats, remuxFormatMOV)
+	}
+
+	// Matroska supports nearly every codec.
+	formats = append(formats, remuxFormatMKV)
+
+	return formats
+}
 
-	out, err := exec.Command(lib.FfprobeBin, srcPath).CombinedOutput()
+// Returns whether every video and audio stream described by vidInfo can be copied
+// into a mov container.
+func isMovCompat(vidInfo types.VidInfo) bool {
+	for _, s := range vidInfo.Streams {
+		if s.Type == streamVideo && !s.IsAttachedPic && !slices.Contains(mp4VidCodecs, s.Codec) && !slices.Contains(movVidCodecs, s.Codec) {
+			return false
+		}
+		if s.Type == streamAudio && !slices.Contains(mp4AudCodecs, s.Codec) && !slices.Contains(movAudCodecs, s.Codec) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Writes a small jpeg preview of the first frame of the image or video at srcPath
+// to destPath, small enough to be inlined in the report.
+func CreateThumbnail(srcPath string, destPath string) error {
+	cmdArgs := []string{
+		"-v", "error",
+		"-y",
+		"-i", srcPath,
+		"-vf", "scale=96:-2",
+		"-frames:v", "1",
+		"-q:v", "10",
+		destPath,
+	}
+	out, err := exec.Command(lib.FfmpegBin, cmdArgs...).CombinedOutput()
 	if err != nil {
-		return types.VidInfo{}, fmt.Errorf("error running ffprobe: %s, %s", out, err)
-	}
-	info := string(out)
-
-	// Get video codec and mp4 compatibility info.
-
-	m := regexp.MustCompile(`Video: (\w+)\b`)
-	VidInfo := m.FindStringSubmatch(info)
-	if len(VidInfo) > 0 {
-		vidInfo.VidCodec = VidInfo[1]
-	}
-	vidInfo.IsVidCompat = slices.Contains(
-		[]string{
-			// "mpeg1video", // Disabled due to an error opening the result in QuickTime.
-			"mpeg2video",
-			"mpeg4",
-			"h264",
-		},
-		vidInfo.VidCodec,
-	)
-
-	// Get audio codec and mp4 compatibility info.
-
-	m = regexp.MustCompile(`Audio: (\w+)\b`)
-	audCodecs := m.FindStringSubmatch(info)
-	if len(audCodecs) > 0 {
-		vidInfo.AudCodec = audCodecs[1]
-	}
-	vidInfo.IsAudCompat = slices.Contains(
-		[]string{
-			"h264",
-			"aac",
-			"mp1",
-			"mp2",
-			"mp3",
-			"qcelp",
-			"twinvq",
-			"vorbis",
-			"alac",
-		},
-		vidInfo.AudCodec,
-	)
-
-	// Determine if file can simply be repackaged. (If not, putting it into an
-	// mp4 container would require re-encoding, which is less desirable than
-	// preserving the file as-is.)
-
-	if vidInfo.IsVidCompat && vidInfo.IsAudCompat {
-		vidInfo.CanBeRePackagedInMP4 = true
-	}
-
-	// Get video duration.
+		return errors.Join(err, fmt.Errorf(string(out)))
+	}
+
+	return nil
+}
+
+// The parts of ffprobe's JSON output that are used.
+type ffprobeOutput struct {
+	Streams []ffprobeStream `json:"streams"`
+	Format  struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+}
 
+type ffprobeStream struct {
+	Index       int               `json:"index"`
+	CodecName   string            `json:"codec_name"`
+	CodecType   string            `json:"codec_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	BitRate     string            `json:"bit_rate"`
+	Tags        map[string]string `json:"tags"`
+	Disposition map[string]int    `json:"disposition"`
+	SideData    []struct {
+		Rotation *float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// Returns the streams of the video at srcPath, how each is handled when repackaging
+// in an mp4 container, and the container's duration, bitrate, and creation time.
+func GetVidInfo(srcPath string) (vidInfo types.VidInfo, err error) {
 	args := []string{
-		"-v", "quiet",
-		"-show_entries",
-		"format=duration",
-		"-of", "default=noprint_wrappers=1:nokey=1",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_streams",
+		"-show_format",
 		srcPath,
 	}
-	out, err = exec.Command(lib.FfprobeBin, args...).CombinedOutput()
+	// Errors are written to stderr, so they aren't mixed into the JSON on stdout.
+	out, err := exec.Command(lib.FfprobeBin, args...).Output()
 	if err != nil {
-		return types.VidInfo{}, fmt.Errorf("error running ffprobe: %s, %s", out, err)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return types.VidInfo{}, fmt.Errorf("error running ffprobe: %s, %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return types.VidInfo{}, fmt.Errorf("error running ffprobe: %s", err)
+	}
+
+	return parseVidInfo(out)
+}
+
+// Returns the video info described by out, the JSON output of ffprobe with
+// -show_streams and -show_format.
+func parseVidInfo(out []byte) (vidInfo types.VidInfo, err error) {
+	var probe ffprobeOutput
+	err = json.Unmarshal(out, &probe)
+	if err != nil {
+		return types.VidInfo{}, fmt.Errorf("error parsing ffprobe output: %s", err)
+	}
+
+	vidInfo = types.VidInfo{
+		FormatName: probe.Format.FormatName,
+		BitRate:    parseBitRate(probe.Format.BitRate),
+		Streams:    []types.VidStream{},
 	}
-	durStr := strings.TrimSpace(string(out))
-	dur, err := strconv.ParseFloat(durStr, 64)
+
+	dur, err := strconv.ParseFloat(probe.Format.Duration, 64)
 	if err != nil {
-		return types.VidInfo{}, err
+		return types.VidInfo{}, fmt.Errorf("error parsing duration '%s': %s", probe.Format.Duration, err)
 	}
 	vidInfo.DurationSec = dur
 
+	creationTime, exists := probe.Format.Tags["creation_time"]
+	if exists {
+		t, err := time.Parse(time.RFC3339Nano, creationTime)
+		if err == nil {
+			vidInfo.CreationTime = t
+		}
+	}
+
+	for _, ps := range probe.Streams {
+		s := types.VidStream{
+			Index:         ps.Index,
+			Type:          ps.CodecType,
+			Codec:         ps.CodecName,
+			Width:         ps.Width,
+			Height:        ps.Height,
+			Rotation:      getRotation(ps),
+			BitRate:       parseBitRate(ps.BitRate),
+			Language:      ps.Tags["language"],
+			IsAttachedPic: ps.Disposition["attached_pic"] == 1,
+		}
+		vidInfo.Streams = append(vidInfo.Streams, s)
+
+		if s.Type == streamVideo && !s.IsAttachedPic && vidInfo.VidCodec == "" {
+			vidInfo.VidCodec = s.Codec
+			vidInfo.Rotation = s.Rotation
+		}
+		if s.Type == streamAudio && vidInfo.AudCodec == "" {
+			vidInfo.AudCodec = s.Codec
+		}
+	}
+
+	// Determine how each stream can be repackaged in an mp4 container. (If the
+	// video can't be, putting it into an mp4 container would require re-encoding it,
+	// which is less desirable than preserving the file as-is.)
+
+	vidInfo.StreamDecisions = getStreamDecisions(vidInfo.Streams)
+	vidInfo.IsVidCompat = vidInfo.VidCodec != ""
+	vidInfo.IsAudCompat = vidInfo.AudCodec != ""
+	vidInfo.CanBeRePackagedInMP4 = vidInfo.VidCodec != ""
+	for _, d := range vidInfo.StreamDecisions {
+		if d.Stream == streamVideo && d.Action == types.StreamActionUnsupported {
+			vidInfo.IsVidCompat = false
+		} else if d.Stream == streamAudio && d.Action != types.StreamActionCopy {
+			vidInfo.IsAudCompat = false
+		}
+		if d.Action == types.StreamActionUnsupported {
+			vidInfo.CanBeRePackagedInMP4 = false
+		}
+	}
+
 	return vidInfo, nil
 }
+
+// Returns the clockwise rotation in degrees of s's display, from the rotate tag
+// written by older ffprobe versions, or else the display matrix, whose rotation is
+// counterclockwise.
+func getRotation(s ffprobeStream) int {
+	rotation := 0
+	rotate, exists := s.Tags["rotate"]
+	if exists {
+		rotation, _ = strconv.Atoi(rotate)
+	} else {
+		for _, sd := range s.SideData {
+			if sd.Rotation != nil {
+				rotation = -int(*sd.Rotation)
+				break
+			}
+		}
+	}
+
+	return ((rotation % 360) + 360) % 360
+}
+
+// Returns the bitrate in bits per second in s, or 0 if it's unknown.
+func parseBitRate(s string) int64 {
+	bitRate, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return bitRate
+}
@@ -0,0 +1,440 @@
+package encode
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"porte/config"
+	"porte/types"
+)
+
+func TestGetRemuxFormats(t *testing.T) {
+	type Iter struct {
+		vidInfo         types.VidInfo
+		ext             string
+		expectedFormats []string
+	}
+
+	var iters = []Iter{
+		{
+			vidInfo:         types.VidInfo{VidCodec: "h264", IsVidCompat: true, AudCodec: "aac", IsAudCompat: true, CanBeRePackagedInMP4: true, Streams: getTestStreams("h264", "aac")},
+			ext:             ".mov",
+			expectedFormats: []string{"mp4"},
+		},
+		{
+			vidInfo:         types.VidInfo{VidCodec: "mjpeg", AudCodec: "pcm_u8", Streams: getTestStreams("mjpeg", "pcm_u8")},
+			ext:             ".avi",
+			expectedFormats: []string{"mov", "matroska"},
+		},
+		{
+			vidInfo:         types.VidInfo{VidCodec: "mpeg4", IsVidCompat: true, AudCodec: "mp3", IsAudCompat: true, CanBeRePackagedInMP4: true, Streams: getTestStreams("mpeg4", "mp3")},
+			ext:             ".avi",
+			expectedFormats: []string{"mp4", "mov", "matroska"},
+		},
+		{
+			vidInfo:         types.VidInfo{VidCodec: "msmpeg4v3", AudCodec: "wmav2", Streams: getTestStreams("msmpeg4v3", "wmav2")},
+			ext:             ".wmv",
+			expectedFormats: []string{"matroska"},
+		},
+		{
+			vidInfo:         types.VidInfo{VidCodec: "vp9", AudCodec: "opus", Streams: getTestStreams("vp9", "opus")},
+			ext:             ".webm",
+			expectedFormats: []string{},
+		},
+	}
+
+	for _, iter := range iters {
+		formats := getRemuxFormats(iter.vidInfo, iter.ext)
+		if fmt.Sprint(formats) != fmt.Sprint(iter.expectedFormats) {
+			t.Fatalf("Expected formats %v for %s with %+v, but got %v", iter.expectedFormats, iter.ext, iter.vidInfo, formats)
+		}
+
+		fmt.Printf("Got formats %v for %s with %s and %s\n", formats, iter.ext, iter.vidInfo.VidCodec, iter.vidInfo.AudCodec)
+	}
+}
+
+// Returns a video stream with vidCodec and, unless audCodec is empty, an audio
+// stream with audCodec.
+func getTestStreams(vidCodec string, audCodec string) []types.VidStream {
+	streams := []types.VidStream{{Index: 0, Type: "video", Codec: vidCodec}}
+	if audCodec != "" {
+		streams = append(streams, types.VidStream{Index: 1, Type: "audio", Codec: audCodec})
+	}
+	return streams
+}
+
+func TestGetStreamDecisions(t *testing.T) {
+	type Iter struct {
+		streams         []types.VidStream
+		expectedActions []types.StreamAction
+		expectedArgs    []string
+	}
+
+	var iters = []Iter{
+		{
+			streams:         getTestStreams("h264", "aac"),
+			expectedActions: []types.StreamAction{types.StreamActionCopy, types.StreamActionCopy},
+			expectedArgs:    []string{"-map", "0:0", "-c:0", "copy", "-map", "0:1", "-c:1", "copy"},
+		},
+		{
+			streams:         getTestStreams("hevc", "aac"),
+			expectedActions: []types.StreamAction{types.StreamActionCopyHvc1, types.StreamActionCopy},
+			expectedArgs:    []string{"-map", "0:0", "-c:0", "copy", "-tag:0", "hvc1", "-map", "0:1", "-c:1", "copy"},
+		},
+		{
+			streams:         getTestStreams("h264", "pcm_s16le"),
+			expectedActions: []types.StreamAction{types.StreamActionCopy, types.StreamActionTranscode},
+			expectedArgs:    []string{"-map", "0:0", "-c:0", "copy", "-map", "0:1", "-c:1", "aac", "-b:1", "192k"},
+		},
+		{
+			streams:         getTestStreams("mpeg4", "amr_nb"),
+			expectedActions: []types.StreamAction{types.StreamActionCopy, types.StreamActionTranscode},
+			expectedArgs:    []string{"-map", "0:0", "-c:0", "copy", "-map", "0:1", "-c:1", "aac", "-b:1", "192k"},
+		},
+		{
+			streams:         getTestStreams("h264", ""),
+			expectedActions: []types.StreamAction{types.StreamActionCopy},
+			expectedArgs:    []string{"-map", "0:0", "-c:0", "copy"},
+		},
+		{
+			streams:         getTestStreams("mjpeg", "ac3"),
+			expectedActions: []types.StreamAction{types.StreamActionUnsupported, types.StreamActionCopy},
+			expectedArgs:    []string{"-map", "0:1", "-c:0", "copy"},
+		},
+		{
+			streams: []types.VidStream{
+				{Index: 0, Type: "data", Codec: "bin_data"},
+				{Index: 1, Type: "video", Codec: "h264"},
+				{Index: 2, Type: "audio", Codec: "aac", Language: "eng"},
+				{Index: 3, Type: "audio", Codec: "pcm_s16le", Language: "fra"},
+				{Index: 4, Type: "subtitle", Codec: "subrip"},
+				{Index: 5, Type: "subtitle", Codec: "dvd_subtitle"},
+				{Index: 6, Type: "video", Codec: "mjpeg", IsAttachedPic: true},
+			},
+			expectedActions: []types.StreamAction{
+				types.StreamActionDrop,
+				types.StreamActionCopy,
+				types.StreamActionCopy,
+				types.StreamActionTranscode,
+				types.StreamActionTranscode,
+				types.StreamActionDrop,
+				types.StreamActionDrop,
+			},
+			expectedArgs: []string{
+				"-map", "0:1", "-c:0", "copy",
+				"-map", "0:2", "-c:1", "copy",
+				"-map", "0:3", "-c:2", "aac", "-b:2", "192k",
+				"-map", "0:4", "-c:3", "mov_text",
+			},
+		},
+	}
+
+	for _, iter := range iters {
+		decisions := getStreamDecisions(iter.streams)
+		actions := []types.StreamAction{}
+		for _, d := range decisions {
+			actions = append(actions, d.Action)
+		}
+		if fmt.Sprint(actions) != fmt.Sprint(iter.expectedActions) {
+			t.Fatalf("Expected actions %v for %+v, but got %v", iter.expectedActions, iter.streams, actions)
+		}
+
+		args := getStreamArgs(decisions)
+		if fmt.Sprint(args) != fmt.Sprint(iter.expectedArgs) {
+			t.Fatalf("Expected args %v for %+v, but got %v", iter.expectedArgs, iter.streams, args)
+		}
+
+		fmt.Printf("Got actions %v for %d streams\n", actions, len(iter.streams))
+	}
+}
+
+func TestGetRemuxDecisions(t *testing.T) {
+	type Iter struct {
+		format       string
+		expectedArgs []string
+	}
+
+	// A camera AVI with motion jpeg video, two pcm audio tracks, text and bitmap
+	// subtitles, and cover art.
+	streams := []types.VidStream{
+		{Index: 0, Type: "video", Codec: "mjpeg"},
+		{Index: 1, Type: "audio", Codec: "pcm_u8", Language: "eng"},
+		{Index: 2, Type: "audio", Codec: "pcm_u8", Language: "fra"},
+		{Index: 3, Type: "subtitle", Codec: "subrip"},
+		{Index: 4, Type: "subtitle", Codec: "dvd_subtitle"},
+		{Index: 5, Type: "video", Codec: "mjpeg", IsAttachedPic: true},
+	}
+
+	var iters = []Iter{
+		{
+			format: "mov",
+			expectedArgs: []string{
+				"-map", "0:0", "-c:0", "copy",
+				"-map", "0:1", "-c:1", "copy",
+				"-map", "0:2", "-c:2", "copy",
+				"-map", "0:3", "-c:3", "mov_text",
+			},
+		},
+		{
+			format: "matroska",
+			expectedArgs: []string{
+				"-map", "0:0", "-c:0", "copy",
+				"-map", "0:1", "-c:1", "copy",
+				"-map", "0:2", "-c:2", "copy",
+				"-map", "0:3", "-c:3", "copy",
+				"-map", "0:4", "-c:4", "copy",
+			},
+		},
+	}
+
+	for _, iter := range iters {
+		args := getStreamArgs(getRemuxDecisions(getStreamDecisions(streams), iter.format))
+		if fmt.Sprint(args) != fmt.Sprint(iter.expectedArgs) {
+			t.Fatalf("Expected args %v for %s, but got %v", iter.expectedArgs, iter.format, args)
+		}
+
+		fmt.Printf("Got args %v for %s\n", args, iter.format)
+	}
+}
+
+// ffprobe output for an iPhone HEVC video in portrait, with Apple's metadata and
+// timecode streams.
+const testProbePhoneMov = `{
+    "streams": [
+        {
+            "index": 0,
+            "codec_name": "hevc",
+            "codec_type": "video",
+            "width": 1920,
+            "height": 1080,
+            "bit_rate": "7961497",
+            "disposition": {"default": 1, "attached_pic": 0},
+            "tags": {"creation_time": "2023-06-15T18:24:21.000000Z", "language": "und"},
+            "side_data_list": [
+                {"side_data_type": "Display Matrix", "displaymatrix": "...", "rotation": -90}
+            ]
+        },
+        {
+            "index": 1,
+            "codec_name": "aac",
+            "codec_type": "audio",
+            "bit_rate": "175477",
+            "disposition": {"default": 1, "attached_pic": 0},
+            "tags": {"language": "und"}
+        },
+        {
+            "index": 2,
+            "codec_type": "data",
+            "bit_rate": "135",
+            "disposition": {"default": 1, "attached_pic": 0},
+            "tags": {"handler_name": "Core Media Metadata"}
+        },
+        {
+            "index": 3,
+            "codec_type": "data",
+            "disposition": {"default": 1, "attached_pic": 0},
+            "tags": {"handler_name": "Core Media Metadata", "timecode": "00:00:00:00"}
+        }
+    ],
+    "format": {
+        "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+        "duration": "12.345000",
+        "bit_rate": "8148576",
+        "tags": {"creation_time": "2023-06-15T18:24:21.000000Z"}
+    }
+}`
+
+// ffprobe output, from an older version, for an AVI from a compact camera, with
+// motion jpeg video rotated by its tag and pcm audio.
+const testProbeCameraAvi = `{
+    "streams": [
+        {
+            "index": 0,
+            "codec_name": "mjpeg",
+            "codec_type": "video",
+            "width": 640,
+            "height": 480,
+            "bit_rate": "N/A",
+            "disposition": {"default": 0, "attached_pic": 0},
+            "tags": {"rotate": "270"}
+        },
+        {
+            "index": 1,
+            "codec_name": "pcm_u8",
+            "codec_type": "audio",
+            "bit_rate": "88200",
+            "disposition": {"default": 0, "attached_pic": 0}
+        },
+        {
+            "index": 2,
+            "codec_name": "subrip",
+            "codec_type": "subtitle",
+            "disposition": {"default": 0, "attached_pic": 0},
+            "tags": {"language": "eng"}
+        }
+    ],
+    "format": {
+        "format_name": "avi",
+        "duration": "4.500000",
+        "bit_rate": "12345678"
+    }
+}`
+
+func TestParseVidInfo(t *testing.T) {
+	type Iter struct {
+		name            string
+		out             string
+		expectedVidInfo types.VidInfo
+	}
+
+	var iters = []Iter{
+		{
+			name: "phone mov",
+			out:  testProbePhoneMov,
+			expectedVidInfo: types.VidInfo{
+				VidCodec:             "hevc",
+				IsVidCompat:          true,
+				AudCodec:             "aac",
+				IsAudCompat:          true,
+				CanBeRePackagedInMP4: true,
+				DurationSec:          12.345,
+				FormatName:           "mov,mp4,m4a,3gp,3g2,mj2",
+				BitRate:              8148576,
+				CreationTime:         time.Date(2023, 6, 15, 18, 24, 21, 0, time.UTC),
+				Rotation:             90,
+				Streams: []types.VidStream{
+					{Index: 0, Type: "video", Codec: "hevc", Width: 1920, Height: 1080, Rotation: 90, BitRate: 7961497, Language: "und"},
+					{Index: 1, Type: "audio", Codec: "aac", BitRate: 175477, Language: "und"},
+					{Index: 2, Type: "data", BitRate: 135},
+					{Index: 3, Type: "data"},
+				},
+			},
+		},
+		{
+			name: "camera avi",
+			out:  testProbeCameraAvi,
+			expectedVidInfo: types.VidInfo{
+				VidCodec:    "mjpeg",
+				AudCodec:    "pcm_u8",
+				DurationSec: 4.5,
+				FormatName:  "avi",
+				BitRate:     12345678,
+				Rotation:    270,
+				Streams: []types.VidStream{
+					{Index: 0, Type: "video", Codec: "mjpeg", Width: 640, Height: 480, Rotation: 270},
+					{Index: 1, Type: "audio", Codec: "pcm_u8", BitRate: 88200},
+					{Index: 2, Type: "subtitle", Codec: "subrip", Language: "eng"},
+				},
+			},
+		},
+	}
+
+	for _, iter := range iters {
+		vidInfo, err := parseVidInfo([]byte(iter.out))
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", iter.name, err)
+		}
+
+		// Stream decisions are covered by TestGetStreamDecisions.
+		vidInfo.StreamDecisions = nil
+		if fmt.Sprintf("%+v", vidInfo) != fmt.Sprintf("%+v", iter.expectedVidInfo) {
+			t.Fatalf("Expected %+v for %s, but got %+v", iter.expectedVidInfo, iter.name, vidInfo)
+		}
+
+		fmt.Printf("Parsed %s as %s with %d streams\n", iter.name, vidInfo.FormatName, len(vidInfo.Streams))
+	}
+
+	_, err := parseVidInfo([]byte(`{"streams": [], "format": {"format_name": "avi"}}`))
+	if err == nil {
+		t.Fatalf("Expected an error for output without a duration")
+	}
+}
+
+func TestEstimateTranscodeDuration(t *testing.T) {
+	type Iter struct {
+		vidInfo          types.VidInfo
+		preset           string
+		expectedNeeds    bool
+		expectedDuration time.Duration
+	}
+
+	var iters = []Iter{
+		{
+			vidInfo:          types.VidInfo{VidCodec: "h263", AudCodec: "amr_nb", DurationSec: 60},
+			preset:           "medium",
+			expectedNeeds:    true,
+			expectedDuration: 42 * time.Second,
+		},
+		{
+			vidInfo:          types.VidInfo{VidCodec: "wmv2", AudCodec: "wmav2", DurationSec: 10},
+			preset:           "veryslow",
+			expectedNeeds:    true,
+			expectedDuration: 50 * time.Second,
+		},
+		{
+			vidInfo:          types.VidInfo{VidCodec: "h264", AudCodec: "aac", CanBeRePackagedInMP4: true, DurationSec: 60},
+			preset:           "medium",
+			expectedNeeds:    false,
+			expectedDuration: 42 * time.Second,
+		},
+	}
+
+	for _, iter := range iters {
+		needs := NeedsTranscode(iter.vidInfo)
+		if needs != iter.expectedNeeds {
+			t.Fatalf("Expected transcoding needed to be %t for %s, but got %t", iter.expectedNeeds, iter.vidInfo.VidCodec, needs)
+		}
+
+		d := EstimateTranscodeDuration(iter.vidInfo, config.TranscodeConfig{CRF: 23, Preset: iter.preset})
+		if d.Round(time.Second) != iter.expectedDuration {
+			t.Fatalf("Expected %s for %s, but got %s", iter.expectedDuration, iter.vidInfo.VidCodec, d)
+		}
+
+		fmt.Printf("Expected %s to transcode %s\n", d, iter.vidInfo.VidCodec)
+	}
+}
+
+func TestGetTranscodeStreamArgs(t *testing.T) {
+	// A 3GP with H.263 video, two AMR audio tracks, subtitles, and a data stream.
+	vidInfo := types.VidInfo{
+		Streams: []types.VidStream{
+			{Index: 0, Type: "video", Codec: "h263"},
+			{Index: 1, Type: "audio", Codec: "amr_nb"},
+			{Index: 2, Type: "audio", Codec: "amr_nb"},
+			{Index: 3, Type: "subtitle", Codec: "subrip"},
+			{Index: 4, Type: "data", Codec: "bin_data"},
+			{Index: 5, Type: "video", Codec: "h263"},
+		},
+	}
+	expectedActions := []types.StreamAction{
+		types.StreamActionTranscode,
+		types.StreamActionTranscode,
+		types.StreamActionTranscode,
+		types.StreamActionTranscode,
+		types.StreamActionDrop,
+		types.StreamActionDrop,
+	}
+	expectedArgs := []string{
+		"-map", "0:0", "-c:0", "libx264", "-crf:0", "23", "-preset:0", "medium", "-pix_fmt:0", "yuv420p",
+		"-map", "0:1", "-c:1", "aac", "-b:1", "192k",
+		"-map", "0:2", "-c:2", "aac", "-b:2", "192k",
+		"-map", "0:3", "-c:3", "mov_text",
+	}
+
+	decisions := getTranscodeDecisions(vidInfo)
+	actions := []types.StreamAction{}
+	for _, d := range decisions {
+		actions = append(actions, d.Action)
+	}
+	if fmt.Sprint(actions) != fmt.Sprint(expectedActions) {
+		t.Fatalf("Expected actions %v, but got %v", expectedActions, actions)
+	}
+
+	args := getTranscodeStreamArgs(decisions, config.TranscodeConfig{CRF: 23, Preset: "medium"})
+	if fmt.Sprint(args) != fmt.Sprint(expectedArgs) {
+		t.Fatalf("Expected args %v, but got %v", expectedArgs, args)
+	}
+
+	fmt.Printf("Got transcode args %v\n", args)
+}
@@ -0,0 +1,140 @@
+package encode
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"porte/config"
+	"porte/lib"
+	"porte/types"
+)
+
+// Rough encoding time per second of video for each x264 preset, for a typical phone
+// video. Actual times depend on resolution and hardware.
+var transcodeSecPerVidSec = map[string]float64{
+	"ultrafast": 0.1,
+	"superfast": 0.15,
+	"veryfast":  0.25,
+	"faster":    0.4,
+	"fast":      0.5,
+	"medium":    0.7,
+	"slow":      1.2,
+	"slower":    2.5,
+	"veryslow":  5,
+}
+
+// Returns whether the video described by vidInfo can only be put in an mp4
+// container by re-encoding it.
+func NeedsTranscode(vidInfo types.VidInfo) bool {
+	return vidInfo.VidCodec != "" && !vidInfo.CanBeRePackagedInMP4
+}
+
+// Returns a rough estimate of how long transcoding the video described by vidInfo
+// with profile will take.
+func EstimateTranscodeDuration(vidInfo types.VidInfo, profile config.TranscodeConfig) time.Duration {
+	factor, exists := transcodeSecPerVidSec[profile.Preset]
+	if !exists {
+		factor = 1
+	}
+
+	return time.Duration(vidInfo.DurationSec * factor * float64(time.Second))
+}
+
+// Returns how each stream of the video described by vidInfo is handled when
+// transcoding it. The first video stream is re-encoded as H.264, and every audio
+// stream as AAC. Subtitles are handled as when repackaging in mp4, and anything
+// else is dropped.
+func getTranscodeDecisions(vidInfo types.VidInfo) []types.StreamDecision {
+	decisions := []types.StreamDecision{}
+	hasVid := false
+	for _, d := range getStreamDecisions(vidInfo.Streams) {
+		switch d.Stream {
+		case streamVideo:
+			// Cover art stays dropped.
+			if d.Action != types.StreamActionDrop && hasVid {
+				d.Action = types.StreamActionDrop
+				d.Reason = "only the first video stream is transcoded"
+			} else if d.Action != types.StreamActionDrop {
+				d.Action = types.StreamActionTranscode
+				d.Reason = "re-encoded as H.264"
+				hasVid = true
+			}
+		case streamAudio:
+			d.Action = types.StreamActionTranscode
+			d.Reason = "re-encoded as AAC"
+		}
+		decisions = append(decisions, d)
+	}
+
+	return decisions
+}
+
+// Returns the ffmpeg arguments for mapping each stream kept by decisions to the
+// output and encoding it as decided, with the quality and speed set by profile.
+func getTranscodeStreamArgs(decisions []types.StreamDecision, profile config.TranscodeConfig) []string {
+	args := []string{}
+	outIdx := 0
+	for _, d := range decisions {
+		if d.Action == types.StreamActionDrop || d.Action == types.StreamActionUnsupported {
+			continue
+		}
+
+		args = append(args, "-map", fmt.Sprintf("0:%d", d.Index))
+		spec := strconv.Itoa(outIdx)
+		switch {
+		case d.Stream == streamVideo:
+			args = append(args,
+				"-c:"+spec, "libx264",
+				"-crf:"+spec, strconv.Itoa(profile.CRF),
+				"-preset:"+spec, profile.Preset,
+				// Most players only support 4:2:0 chroma subsampling.
+				"-pix_fmt:"+spec, "yuv420p",
+			)
+		case d.Stream == streamAudio:
+			args = append(args, "-c:"+spec, "aac", "-b:"+spec, aacBitrate)
+		case d.Stream == streamSubtitle && d.Action == types.StreamActionTranscode:
+			args = append(args, "-c:"+spec, "mov_text")
+		default:
+			args = append(args, "-c:"+spec, "copy")
+		}
+		outIdx++
+	}
+
+	return args
+}
+
+// Re-encodes the video at srcPath as H.264 and AAC in an mp4 container in tmpDir,
+// with the quality and speed set by profile. Every audio track, subtitles that mp4
+// supports, chapters, and all metadata are carried over, along with meta, which is
+// written the same as when repackaging. Returns how each stream was handled.
+func TranscodeVideo(fileInfo types.FileInfo, srcPath string, tmpDir string, fileNameNoExt string, meta VidMetadata, profile config.TranscodeConfig) (destPath string, decisions []types.StreamDecision, err error) {
+	if fileInfo.MediaKind != types.Video {
+		return "", nil, errors.New("file is not a video")
+	}
+
+	decisions = getTranscodeDecisions(fileInfo.VidInfo)
+
+	destPath = filepath.Join(tmpDir, fileNameNoExt) + remuxFormatExts[remuxFormatMP4]
+	cmdArgs := []string{
+		"-y",
+		"-i", srcPath,
+		"-map_metadata", "0",
+		"-map_chapters", "0",
+		"-f", remuxFormatMP4,
+	}
+	cmdArgs = append(cmdArgs, getTranscodeStreamArgs(decisions, profile)...)
+	cmdArgs = append(cmdArgs, "-movflags", "+faststart")
+	cmdArgs = append(cmdArgs, getMetadataArgs(meta)...)
+	cmdArgs = append(cmdArgs, destPath)
+
+	out, err := exec.Command(lib.FfmpegBin, cmdArgs...).CombinedOutput()
+	if err != nil {
+		return "", decisions, errors.Join(err, fmt.Errorf(string(out)))
+	}
+
+	return destPath, decisions, nil
+}
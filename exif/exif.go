@@ -6,13 +6,17 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"porte/config"
 	"porte/lib"
 	"porte/types"
 	"porte/utils"
+
+	"golang.org/x/exp/slices"
 )
 
 type googleInfo struct {
@@ -32,22 +36,25 @@ type googleInfo struct {
 		Formatted string
 	}
 	GeoData struct {
-		Latitude      float32
-		Longitude     float32
-		Altitude      float32
-		LatitudeSpan  float32
-		LongitudeSpan float32
+		Latitude      float64
+		Longitude     float64
+		Altitude      float64
+		LatitudeSpan  float64
+		LongitudeSpan float64
 	}
 	GeoDataExif struct {
-		Latitude      float32
-		Longitude     float32
-		Altitude      float32
-		LatitudeSpan  float32
-		LongitudeSpan float32
-	}
-	People [](struct {
-		name string
-	})
+		Latitude      float64
+		Longitude     float64
+		Altitude      float64
+		LatitudeSpan  float64
+		LongitudeSpan float64
+	}
+	People []struct {
+		Name string
+	}
+	Favorited          bool
+	Archived           bool
+	Trashed            bool
 	Url                string
 	GooglePhotosOrigin struct {
 		PhotosDesktopUploader struct {
@@ -55,6 +62,13 @@ type googleInfo struct {
 	}
 }
 
+// Map of exif date tag name to the name of the tag holding its UTC offset.
+var exifOffsetTagNames = map[string]string{
+	"DateTimeOriginal": "OffsetTimeOriginal",
+	"CreateDate":       "OffsetTimeDigitized",
+	"ModifyDate":       "OffsetTime",
+}
+
 // Returns all exif tags from the file at srcPath.
 func GetAllExifTags(srcPath string) (tags types.ExifTags, err error) {
 	tags = types.ExifTags{
@@ -86,13 +100,12 @@ func GetAllExifTags(srcPath string) (tags types.ExifTags, err error) {
 		}
 	}
 
-	// Get date tags.
+	// Get date tags, keeping each value in its raw form so that any zone it
+	// includes is preserved, along with each tag's group.
 
 	cmdArgs := []string{
-		"-api", "TimeZone=UTC",
+		"-G",
 		"-time:all",
-		"-d", utils.ExifToolDateFmt,
-		"-c", "%.6f",
 		"-j",
 		srcPath,
 	}
@@ -103,9 +116,10 @@ func GetAllExifTags(srcPath string) (tags types.ExifTags, err error) {
 	}
 
 	rawExifTagMap = parseJSONResponse(out)
-	for n, t := range rawExifTagMap {
+	for gn, t := range rawExifTagMap {
+		group, n := splitGroupName(gn)
 		v := fmt.Sprint(t)
-		d, err := time.Parse(utils.GoParseExifToolDateFmt, v)
+		d, hasZone, err := utils.ParseExifDate(v)
 		if err != nil {
 			continue
 		}
@@ -131,15 +145,31 @@ func GetAllExifTags(srcPath string) (tags types.ExifTags, err error) {
 			continue
 		}
 
+		// QuickTime dates are stored in UTC by definition.
+		if !hasZone && group == "QuickTime" {
+			hasZone = true
+		}
+
+		// Exif dates are wall-clock times, with their offset stored in a separate tag.
+		offsetTagName, exists := exifOffsetTagNames[n]
+		if !hasZone && group == "EXIF" && exists {
+			loc, err := utils.ParseExifOffset(tags.Misc[offsetTagName].Value)
+			if err == nil {
+				d = utils.WallClockIn(d, loc)
+				hasZone = true
+			}
+		}
+
 		tags.Dates[n] = types.ExifDateTag{
-			Name: n,
-			Date: d,
+			Name:    n,
+			Date:    d,
+			HasZone: hasZone,
 		}
 	}
 
 	// Get geo tags.
 
-	cmd = exec.Command(lib.ExiftoolBin, "-a", "-gps:all", "-c", "%.6f", "-j", srcPath)
+	cmd = exec.Command(lib.ExiftoolBin, "-a", "-gps:all", "-GPSCoordinates", "-c", "%.6f", "-j", srcPath)
 	out, err = cmd.CombinedOutput()
 	if err != nil {
 		return types.ExifTags{}, err
@@ -176,6 +206,21 @@ func GetExifMimeType(srcPath string) (mimeType string, err error) {
 	return mimeType, nil
 }
 
+// Returns the thumbnail image embedded in the exif data of the file at srcPath,
+// if one exists.
+func GetExifThumbnail(srcPath string) ([]byte, error) {
+	cmd := exec.Command(lib.ExiftoolBin, "-b", "-ThumbnailImage", srcPath)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no embedded thumbnail")
+	}
+
+	return out, nil
+}
+
 // Returns a valid extension (including the . prefix) based on the exif data in tags,
 // or the original extension if a different one isn't found.
 func GetExifFileExt(miscTags map[string]types.ExifStrTag, ext string) string {
@@ -223,33 +268,48 @@ func GetSupplementaryExifTags(srcPath string, supplFileInfoMap types.FileInfoMap
 			},
 		},
 		Dates: map[string]types.ExifDateTag{
-			"DateTime": {
-				Name: "DateTime",
-				Date: unixToDate(googleInfo.PhotoLastModifiedTime.Timestamp),
-			},
-			"DateTimeOriginal": {
-				Name: "DateTimeOriginal",
-				Date: unixToDate(googleInfo.PhotoTakenTime.Timestamp),
-			},
-			"DateTimeDigitized": {
-				Name: "DateTimeDigitized",
-				Date: unixToDate(googleInfo.PhotoTakenTime.Timestamp),
-			},
-		},
-		Geo: map[string]types.ExifStrTag{
-			"GPSLatitude": {
-				Name:  "GPSLatitude",
-				Value: fmt.Sprint(googleInfo.GeoData.Latitude),
+			"photoTakenTime": {
+				Name:    "photoTakenTime",
+				Date:    unixToDate(googleInfo.PhotoTakenTime.Timestamp),
+				HasZone: true,
 			},
-			"GPSLongitude": {
-				Name:  "GPSLongitude",
-				Value: fmt.Sprint(googleInfo.GeoData.Longitude),
+			"creationTime": {
+				Name:    "creationTime",
+				Date:    unixToDate(googleInfo.CreationTime.Timestamp),
+				HasZone: true,
 			},
-			"GPSAltitude": {
-				Name:  "GPSAltitude",
-				Value: fmt.Sprint(googleInfo.GeoData.Altitude),
+			"photoLastModifiedTime": {
+				Name:    "photoLastModifiedTime",
+				Date:    unixToDate(googleInfo.PhotoLastModifiedTime.Timestamp),
+				HasZone: true,
 			},
 		},
+		Geo:     getSupplGeoTags(googleInfo.GeoData.Latitude, googleInfo.GeoData.Longitude, googleInfo.GeoData.Altitude),
+		GeoExif: getSupplGeoTags(googleInfo.GeoDataExif.Latitude, googleInfo.GeoDataExif.Longitude, googleInfo.GeoDataExif.Altitude),
+	}
+
+	if strings.TrimSpace(googleInfo.Description) != "" {
+		tags.Misc["Description"] = types.ExifStrTag{
+			Name:  "Description",
+			Value: strings.TrimSpace(googleInfo.Description),
+		}
+	}
+
+	for _, p := range googleInfo.People {
+		name := strings.TrimSpace(p.Name)
+		if name != "" && !slices.Contains(tags.People, name) {
+			tags.People = append(tags.People, name)
+		}
+	}
+
+	if googleInfo.Favorited {
+		tags.Flags = append(tags.Flags, types.FlagFavorited)
+	}
+	if googleInfo.Archived {
+		tags.Flags = append(tags.Flags, types.FlagArchived)
+	}
+	if googleInfo.Trashed {
+		tags.Flags = append(tags.Flags, types.FlagTrashed)
 	}
 
 	// Clean up bad values.
@@ -259,44 +319,97 @@ func GetSupplementaryExifTags(srcPath string, supplFileInfoMap types.FileInfoMap
 			delete(tags.Dates, n)
 		}
 	}
-	for n, t := range tags.Geo {
-		if t.Value == "" {
-			delete(tags.Geo, n)
-		}
-		f, err := strconv.ParseFloat(t.Value, 32)
-		if err != nil {
-			continue
-		}
-		if f == 0 {
-			delete(tags.Geo, n)
-		}
-	}
 
 	// Report.
 
 	return filePath, tags, nil
 }
 
+// Returns geo tags for a Google Photos location, leaving out zero values, which
+// Google Photos writes when a value is unknown.
+func getSupplGeoTags(lat float64, lon float64, alt float64) map[string]types.ExifStrTag {
+	tags := map[string]types.ExifStrTag{}
+	values := map[string]float64{
+		"GPSLatitude":  lat,
+		"GPSLongitude": lon,
+		"GPSAltitude":  alt,
+	}
+	for n, v := range values {
+		if v != 0 {
+			tags[n] = types.ExifStrTag{Name: n, Value: fmt.Sprint(v)}
+		}
+	}
+
+	return tags
+}
+
 type SetExifTagsArg struct {
 	// The path to a source file from which all tags should be copied.
-	TagsPath string
-	Title    string
-	Date     time.Time
-	Geo      []types.ExifStrTag
+	TagsPath  string
+	MediaKind types.MediaKind
+	Title     string
+	// Written to every description tag for the media kind, unless empty.
+	Description string
+	// Added to the people and keyword tags, without duplicating existing names.
+	People []string
+	// Added to the keyword tags, without duplicating existing keywords.
+	Keywords []string
+	// The XMP rating and label, unless zero or empty.
+	Rating int
+	Label  string
+	Date   time.Time
+	// Whether Date's location is its actual time zone, in which case the offset
+	// tags are set too.
+	HasZone bool
+	// Written to every GPS tag group for the media kind, unless nil.
+	Geo *types.GeoLocation
+	// If set, the file is copied unchanged and the tags are written to a new XMP
+	// sidecar file at this path instead.
+	SidecarPath string
 }
 
 // Copies the file at srcPath to a new file at destPath, copying all tags from the
-// file at tags.TagsPath and then setting all date-related exif tags to tags.Date,
-// the title tag to tags.Title, etc.
+// file at tags.TagsPath and then setting every date tag the file's format supports
+// to tags.Date, the title tag to tags.Title, etc. The date is read back afterward
+// to verify it was written.
 func SetExifTags(srcPath string, destPath string, tags SetExifTagsArg) error {
+	if tags.SidecarPath != "" {
+		return setSidecarTags(srcPath, destPath, tags)
+	}
+
+	format := getWriteFormat(filepath.Ext(destPath), tags.MediaKind)
+
 	cmdArgs := []string{}
 	cmdArgs = append(cmdArgs, "-TagsFromFile", tags.TagsPath)
 	cmdArgs = append(cmdArgs, fmt.Sprintf("-Title=%s", tags.Title))
-	cmdArgs = append(cmdArgs, fmt.Sprintf("-AllDates=%s", tags.Date.Format(utils.GoParseExifToolDateFmt)))
-	for _, t := range tags.Geo {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("-%s=%s", t.Name, t.Value))
+	if format.QuickTime {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-QuickTime:Title=%s", tags.Title))
 	}
-	cmdArgs = append(cmdArgs, "-o", destPath, srcPath)
+	cmdArgs = append(cmdArgs, getDateArgs(tags.Date, tags.HasZone, format)...)
+	if tags.Description != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-XMP-dc:Description=%s", tags.Description))
+		if format.Exif {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-EXIF:ImageDescription=%s", tags.Description))
+		}
+		if format.IPTC {
+			cmdArgs = append(cmdArgs, "-IPTC:CodedCharacterSet=UTF8")
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-IPTC:Caption-Abstract=%s", tags.Description))
+		}
+		if format.QuickTime {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-QuickTime:Description=%s", tags.Description))
+		}
+	}
+	keywordTagNames := []string{"XMP-dc:Subject"}
+	if format.IPTC {
+		keywordTagNames = append(keywordTagNames, "IPTC:Keywords")
+	}
+	cmdArgs = append(cmdArgs, getListArgs(append([]string{"XMP-iptcExt:PersonInImage"}, keywordTagNames...), tags.People)...)
+	cmdArgs = append(cmdArgs, getListArgs(keywordTagNames, tags.Keywords)...)
+	cmdArgs = append(cmdArgs, getRatingArgs(tags)...)
+	if tags.Geo != nil {
+		cmdArgs = append(cmdArgs, getGeoArgs(*tags.Geo, format)...)
+	}
+	cmdArgs = append(cmdArgs, "-charset", "iptc=UTF8", "-o", destPath, srcPath)
 
 	cmd := exec.Command(lib.ExiftoolBin, cmdArgs...)
 	out, err := cmd.CombinedOutput()
@@ -304,9 +417,75 @@ func SetExifTags(srcPath string, destPath string, tags SetExifTagsArg) error {
 		return errors.Join(err, fmt.Errorf(string(out)))
 	}
 
+	return verifyDate(destPath, tags.Date, format)
+}
+
+// Copies the file at srcPath to destPath unchanged, and writes the tags from the
+// file at tags.TagsPath, along with the XMP equivalent of each tag set by
+// SetExifTags, to a new sidecar file at tags.SidecarPath.
+func setSidecarTags(srcPath string, destPath string, tags SetExifTagsArg) error {
+	out, err := exec.Command("cp", srcPath, destPath).CombinedOutput()
+	if err != nil {
+		return errors.Join(err, fmt.Errorf(string(out)))
+	}
+
+	cmdArgs := []string{}
+	cmdArgs = append(cmdArgs, "-TagsFromFile", tags.TagsPath)
+	cmdArgs = append(cmdArgs, fmt.Sprintf("-XMP-dc:Title=%s", tags.Title))
+	cmdArgs = append(cmdArgs, getDateArgs(tags.Date, tags.HasZone, writeFormatXMP)...)
+	if tags.Description != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-XMP-dc:Description=%s", tags.Description))
+	}
+	cmdArgs = append(cmdArgs, getListArgs([]string{"XMP-iptcExt:PersonInImage", "XMP-dc:Subject"}, tags.People)...)
+	cmdArgs = append(cmdArgs, getListArgs([]string{"XMP-dc:Subject"}, tags.Keywords)...)
+	cmdArgs = append(cmdArgs, getRatingArgs(tags)...)
+	if tags.Geo != nil {
+		cmdArgs = append(cmdArgs, getXmpGeoArgs(*tags.Geo)...)
+	}
+	cmdArgs = append(cmdArgs, "-o", tags.SidecarPath, srcPath)
+
+	cmd := exec.Command(lib.ExiftoolBin, cmdArgs...)
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		return errors.Join(err, fmt.Errorf(string(out)))
+	}
+
 	return nil
 }
 
+// Returns the path of the XMP sidecar for the file at path, named by naming.
+func GetSidecarPath(path string, naming config.SidecarNaming) string {
+	if naming == config.SidecarNamingLightroom {
+		return strings.TrimSuffix(path, filepath.Ext(path)) + ".xmp"
+	}
+
+	return path + ".xmp"
+}
+
+// Returns the arguments for exiftool to add each of values to each list tag in
+// tagNames.
+func getListArgs(tagNames []string, values []string) []string {
+	args := []string{}
+	for _, v := range values {
+		for _, n := range tagNames {
+			// Removing the value before adding it avoids duplicating a copied one.
+			args = append(args, fmt.Sprintf("-%s-=%s", n, v), fmt.Sprintf("-%s+=%s", n, v))
+		}
+	}
+	return args
+}
+
+func getRatingArgs(tags SetExifTagsArg) []string {
+	args := []string{}
+	if tags.Rating != 0 {
+		args = append(args, fmt.Sprintf("-XMP:Rating=%d", tags.Rating))
+	}
+	if tags.Label != "" {
+		args = append(args, fmt.Sprintf("-XMP:Label=%s", tags.Label))
+	}
+	return args
+}
+
 // Parses the json response from exiftool and returns a map of the shape
 // {exiftool name: value}. Errors are not handled, in order to return a
 // map, even if empty.
@@ -326,6 +505,16 @@ func parseJSONResponse(out []byte) map[string]interface{} {
 	return m
 }
 
+// Splits a tag name of the form Group:Name, as returned by exiftool with -G.
+func splitGroupName(gn string) (group string, name string) {
+	i := strings.Index(gn, ":")
+	if i < 0 {
+		return "", gn
+	}
+
+	return gn[:i], gn[i+1:]
+}
+
 func unixToDate(u string) time.Time {
 	uInt, _ := strconv.ParseInt(u, 10, 64)
 	t := time.Unix(uInt, 0).UTC()
@@ -0,0 +1,351 @@
+package exif
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"porte/config"
+	"porte/lib"
+	"porte/types"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestGetLatLon(t *testing.T) {
+	type Iter struct {
+		geo         map[string]types.ExifStrTag
+		expectedLat float64
+		expectedLon float64
+	}
+
+	var iters = []Iter{
+		{
+			// Unsigned values with reference tags, as read from a file.
+			geo: map[string]types.ExifStrTag{
+				"GPSLatitude":     {Name: "GPSLatitude", Value: "33.856800"},
+				"GPSLatitudeRef":  {Name: "GPSLatitudeRef", Value: "South"},
+				"GPSLongitude":    {Name: "GPSLongitude", Value: "151.215300"},
+				"GPSLongitudeRef": {Name: "GPSLongitudeRef", Value: "East"},
+			},
+			expectedLat: -33.8568,
+			expectedLon: 151.2153,
+		},
+		{
+			// Signed values, as read from a supplementary file.
+			geo: map[string]types.ExifStrTag{
+				"GPSLatitude":  {Name: "GPSLatitude", Value: "40.694694"},
+				"GPSLongitude": {Name: "GPSLongitude", Value: "-73.950997"},
+			},
+			expectedLat: 40.694694,
+			expectedLon: -73.950997,
+		},
+		{
+			// Unsigned values with the hemisphere in the value.
+			geo: map[string]types.ExifStrTag{
+				"GPSLatitude":  {Name: "GPSLatitude", Value: "22.951900 S"},
+				"GPSLongitude": {Name: "GPSLongitude", Value: "43.210500 W"},
+			},
+			expectedLat: -22.9519,
+			expectedLon: -43.2105,
+		},
+	}
+
+	for _, iter := range iters {
+		lat, lon, ok := GetLatLon(iter.geo)
+		if !ok {
+			t.Fatalf("Expected coordinates in %v", iter.geo)
+		}
+		if lat != iter.expectedLat || lon != iter.expectedLon {
+			t.Fatalf("Expected %f, %f but got %f, %f", iter.expectedLat, iter.expectedLon, lat, lon)
+		}
+
+		fmt.Printf("Found coordinates %f, %f\n", lat, lon)
+	}
+
+	_, _, ok := GetLatLon(map[string]types.ExifStrTag{})
+	if ok {
+		t.Fatal("Expected no coordinates in empty tags")
+	}
+}
+
+func TestGetSupplementaryExifTags(t *testing.T) {
+	type Iter struct {
+		json                string
+		expectedDescription string
+		expectedPeople      []string
+	}
+
+	var iters = []Iter{
+		{
+			json:                `{"title": "IMG_0001.jpg", "description": "Grandma's 80th", "people": [{"name": "Ada"}, {"name": "Grace"}, {"name": "Ada"}]}`,
+			expectedDescription: "Grandma's 80th",
+			expectedPeople:      []string{"Ada", "Grace"},
+		},
+		{
+			json:                `{"title": "IMG_0002.jpg"}`,
+			expectedDescription: "",
+			expectedPeople:      nil,
+		},
+	}
+
+	for _, iter := range iters {
+		dir := t.TempDir()
+		srcPath := filepath.Join(dir, "photo.jpg")
+		supplPath := srcPath + ".json"
+		err := os.WriteFile(supplPath, []byte(iter.json), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, tags, err := GetSupplementaryExifTags(srcPath, types.FileInfoMap{supplPath: {Path: supplPath}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tags.Misc["Description"].Value != iter.expectedDescription {
+			t.Fatalf("Expected description '%s', but got '%s'", iter.expectedDescription, tags.Misc["Description"].Value)
+		}
+		if !slices.Equal(tags.People, iter.expectedPeople) {
+			t.Fatalf("Expected people %v, but got %v", iter.expectedPeople, tags.People)
+		}
+
+		fmt.Printf("Read description '%s' and people %v\n", tags.Misc["Description"].Value, tags.People)
+	}
+}
+
+// Locations in each hemisphere, above and below sea level.
+var hemisphereGeoLocations = []types.GeoLocation{
+	{Lat: 40.689247, Lon: -74.044502, Alt: 93, HasAlt: true},
+	{Lat: -33.856784, Lon: 151.215297, Alt: 5, HasAlt: true},
+	{Lat: -22.951916, Lon: -43.210487, Alt: 700, HasAlt: true},
+	{Lat: 31.559029, Lon: 35.473189, Alt: -430.5, HasAlt: true},
+}
+
+func TestGetGeoArgs(t *testing.T) {
+	type Iter struct {
+		loc          types.GeoLocation
+		expectedArgs []string
+	}
+
+	var iters = []Iter{
+		{loc: hemisphereGeoLocations[0], expectedArgs: []string{"-GPS:GPSLatitudeRef#=N", "-GPS:GPSLongitudeRef#=W", "-GPS:GPSAltitudeRef#=0", "-XMP-exif:GPSLongitude=-74.044502"}},
+		{loc: hemisphereGeoLocations[1], expectedArgs: []string{"-GPS:GPSLatitudeRef#=S", "-GPS:GPSLongitudeRef#=E", "-GPS:GPSLatitude#=33.856784", "-XMP-exif:GPSLatitude=-33.856784"}},
+		{loc: hemisphereGeoLocations[2], expectedArgs: []string{"-GPS:GPSLatitudeRef#=S", "-GPS:GPSLongitudeRef#=W", "-GPS:GPSLongitude#=43.210487"}},
+		{loc: hemisphereGeoLocations[3], expectedArgs: []string{"-GPS:GPSLatitudeRef#=N", "-GPS:GPSLongitudeRef#=E", "-GPS:GPSAltitude#=430.5", "-GPS:GPSAltitudeRef#=1", "-XMP-exif:GPSAltitudeRef#=1"}},
+	}
+
+	for _, iter := range iters {
+		args := getGeoArgs(iter.loc, writeFormatExif)
+		for _, expected := range iter.expectedArgs {
+			if !slices.Contains(args, expected) {
+				t.Fatalf("Expected arg '%s' for %+v, but got %v", expected, iter.loc, args)
+			}
+		}
+
+		vidArgs := getGeoArgs(iter.loc, writeFormatQuickTime)
+		expectedCoords := fmt.Sprintf("-Keys:GPSCoordinates=%.6f, %.6f, %.1f", iter.loc.Lat, iter.loc.Lon, iter.loc.Alt)
+		if !slices.Contains(vidArgs, expectedCoords) {
+			t.Fatalf("Expected arg '%s' for %+v, but got %v", expectedCoords, iter.loc, vidArgs)
+		}
+
+		fmt.Printf("Got args %v for %+v\n", args, iter.loc)
+	}
+}
+
+func TestGeoRoundTrip(t *testing.T) {
+	_, err := lib.GetLibs()
+	if err == nil {
+		_, err = os.Stat(lib.ExiftoolBin)
+	}
+	if err != nil {
+		t.Skipf("Dependencies unavailable: %s", err)
+	}
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.jpg")
+	f, err := os.Create(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = jpeg.Encode(f, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range hemisphereGeoLocations {
+		destPath := filepath.Join(dir, fmt.Sprintf("%d.jpg", i))
+		err := SetExifTags(srcPath, destPath, SetExifTagsArg{
+			TagsPath:  srcPath,
+			MediaKind: types.Image,
+			Date:      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Geo:       &expected,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tags, err := GetAllExifTags(destPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, ok := GetGeoLocation(tags.Geo, "exif")
+		if !ok {
+			t.Fatalf("Expected a location in %v", tags.Geo)
+		}
+
+		if math.Abs(actual.Lat-expected.Lat) > 1e-5 || math.Abs(actual.Lon-expected.Lon) > 1e-5 || math.Abs(actual.Alt-expected.Alt) > 0.1 {
+			t.Fatalf("Expected %+v, but read back %+v", expected, actual)
+		}
+
+		fmt.Printf("Read back %+v\n", actual)
+	}
+}
+
+func TestGetSidecarPath(t *testing.T) {
+	type Iter struct {
+		path         string
+		naming       config.SidecarNaming
+		expectedPath string
+	}
+
+	var iters = []Iter{
+		{path: "out/2020-01-01_00-00-00_IMG_0001.jpg", naming: config.SidecarNamingDarktable, expectedPath: "out/2020-01-01_00-00-00_IMG_0001.jpg.xmp"},
+		{path: "out/2020-01-01_00-00-00_IMG_0001.jpg", naming: config.SidecarNamingLightroom, expectedPath: "out/2020-01-01_00-00-00_IMG_0001.xmp"},
+		{path: "out/clip.avi", naming: config.SidecarNamingLightroom, expectedPath: "out/clip.xmp"},
+	}
+
+	for _, iter := range iters {
+		path := GetSidecarPath(iter.path, iter.naming)
+		if path != iter.expectedPath {
+			t.Fatalf("Expected sidecar '%s' but got '%s'", iter.expectedPath, path)
+		}
+
+		fmt.Printf("Got sidecar '%s' for '%s'\n", path, iter.path)
+	}
+}
+
+func TestSidecarRoundTrip(t *testing.T) {
+	_, err := lib.GetLibs()
+	if err == nil {
+		_, err = os.Stat(lib.ExiftoolBin)
+	}
+	if err != nil {
+		t.Skipf("Dependencies unavailable: %s", err)
+	}
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.jpg")
+	f, err := os.Create(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = jpeg.Encode(f, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	destPath := filepath.Join(dir, "dest.jpg")
+	sidecarPath := GetSidecarPath(destPath, config.SidecarNamingDarktable)
+	expectedGeo := hemisphereGeoLocations[1]
+	err = SetExifTags(srcPath, destPath, SetExifTagsArg{
+		TagsPath:    srcPath,
+		MediaKind:   types.Image,
+		Title:       "src",
+		Description: "Harbour at dusk",
+		People:      []string{"Ada"},
+		Date:        time.Date(2020, 1, 1, 18, 30, 0, 0, time.FixedZone("", 11*60*60)),
+		HasZone:     true,
+		Geo:         &expectedGeo,
+		SidecarPath: sidecarPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcBt, _ := os.ReadFile(srcPath)
+	destBt, _ := os.ReadFile(destPath)
+	if string(srcBt) != string(destBt) {
+		t.Fatalf("Expected '%s' to be unchanged", destPath)
+	}
+
+	tags, err := GetAllExifTags(sidecarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Misc["Description"].Value != "Harbour at dusk" {
+		t.Fatalf("Expected a description in %v", tags.Misc)
+	}
+	actualGeo, ok := GetGeoLocation(tags.Geo, "xmp")
+	if !ok || math.Abs(actualGeo.Lat-expectedGeo.Lat) > 1e-5 || math.Abs(actualGeo.Lon-expectedGeo.Lon) > 1e-5 {
+		t.Fatalf("Expected %+v, but read back %+v", expectedGeo, actualGeo)
+	}
+
+	fmt.Printf("Read back sidecar '%s'\n", sidecarPath)
+}
+
+func TestGetDateArgs(t *testing.T) {
+	type Iter struct {
+		ext            string
+		mediaKind      types.MediaKind
+		hasZone        bool
+		expectedArgs   []string
+		unexpectedArgs []string
+	}
+
+	// 18:30 in Sydney is 07:30 UTC.
+	date := time.Date(2020, 1, 1, 18, 30, 0, 0, time.FixedZone("", 11*60*60))
+
+	var iters = []Iter{
+		{
+			ext:            ".jpg",
+			mediaKind:      types.Image,
+			hasZone:        true,
+			expectedArgs:   []string{"-EXIF:DateTimeOriginal=2020:01:01 18:30:00", "-EXIF:OffsetTimeOriginal=+11:00", "-XMP-exif:DateTimeOriginal=2020:01:01 18:30:00+11:00"},
+			unexpectedArgs: []string{"-QuickTime:CreateDate=2020:01:01 07:30:00"},
+		},
+		{
+			ext:            ".gif",
+			mediaKind:      types.Image,
+			hasZone:        false,
+			expectedArgs:   []string{"-XMP-exif:DateTimeOriginal=2020:01:01 18:30:00"},
+			unexpectedArgs: []string{"-EXIF:DateTimeOriginal=2020:01:01 18:30:00"},
+		},
+		{
+			ext:          ".PNG",
+			mediaKind:    types.Image,
+			hasZone:      true,
+			expectedArgs: []string{"-PNG:CreationTime=2020:01:01 18:30:00+11:00", "-XMP-xmp:CreateDate=2020:01:01 18:30:00+11:00"},
+		},
+		{
+			ext:            ".mov",
+			mediaKind:      types.Video,
+			hasZone:        true,
+			expectedArgs:   []string{"-QuickTime:CreateDate=2020:01:01 07:30:00", "-QuickTime:MediaCreateDate=2020:01:01 07:30:00", "-Keys:CreationDate=2020:01:01 18:30:00+11:00"},
+			unexpectedArgs: []string{"-EXIF:DateTimeOriginal=2020:01:01 18:30:00"},
+		},
+	}
+
+	for _, iter := range iters {
+		args := getDateArgs(date, iter.hasZone, getWriteFormat(iter.ext, iter.mediaKind))
+		for _, expected := range iter.expectedArgs {
+			if !slices.Contains(args, expected) {
+				t.Fatalf("Expected arg '%s' for %s, but got %v", expected, iter.ext, args)
+			}
+		}
+		for _, unexpected := range iter.unexpectedArgs {
+			if slices.Contains(args, unexpected) {
+				t.Fatalf("Expected no arg '%s' for %s, but got %v", unexpected, iter.ext, args)
+			}
+		}
+
+		fmt.Printf("Got args %v for %s\n", args, iter.ext)
+	}
+}
@@ -0,0 +1,218 @@
+package exif
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"porte/lib"
+	"porte/types"
+	"porte/utils"
+
+	"golang.org/x/exp/slices"
+)
+
+// The tag groups written for a container format, since each format supports a
+// different set, and readers look for dates in different places in each.
+type writeFormat struct {
+	// Write dates, descriptions, and GPS tags to EXIF, with the date's offset in the
+	// EXIF offset tags.
+	Exif bool
+	// Write descriptions and keywords to IPTC.
+	IPTC bool
+	// Write the date to the PNG CreationTime text chunk.
+	PNG bool
+	// Write dates to QuickTime in UTC, Keys:CreationDate as a local date, and the
+	// description and GPS coordinates to QuickTime.
+	QuickTime bool
+	// The tag read back after writing to verify the date, like
+	// "EXIF:DateTimeOriginal". Every format also gets XMP.
+	VerifyTag string
+}
+
+var (
+	writeFormatExif = writeFormat{
+		Exif:      true,
+		IPTC:      true,
+		VerifyTag: "EXIF:DateTimeOriginal",
+	}
+	// HEIC and WebP support EXIF and XMP, but not IPTC.
+	writeFormatExifNoIPTC = writeFormat{
+		Exif:      true,
+		VerifyTag: "EXIF:DateTimeOriginal",
+	}
+	// Most readers look for PNG dates in XMP or the CreationTime chunk, rather than
+	// the newer eXIf chunk.
+	writeFormatPNG = writeFormat{
+		Exif:      true,
+		PNG:       true,
+		VerifyTag: "XMP-exif:DateTimeOriginal",
+	}
+	// GIF only supports XMP.
+	writeFormatXMP = writeFormat{
+		VerifyTag: "XMP-exif:DateTimeOriginal",
+	}
+	writeFormatQuickTime = writeFormat{
+		QuickTime: true,
+		VerifyTag: "QuickTime:CreateDate",
+	}
+)
+
+// Write formats by lowercase extension.
+var writeFormats = map[string]writeFormat{
+	".jpg":  writeFormatExif,
+	".jpeg": writeFormatExif,
+	".tif":  writeFormatExif,
+	".tiff": writeFormatExif,
+	".heic": writeFormatExifNoIPTC,
+	".heif": writeFormatExifNoIPTC,
+	".webp": writeFormatExifNoIPTC,
+	".png":  writeFormatPNG,
+	".gif":  writeFormatXMP,
+	".mp4":  writeFormatQuickTime,
+	".m4v":  writeFormatQuickTime,
+	".mov":  writeFormatQuickTime,
+	".3gp":  writeFormatQuickTime,
+}
+
+// Extensions of camera RAW formats.
+var rawExts = []string{
+	".3fr",
+	".arw",
+	".cr2",
+	".cr3",
+	".crw",
+	".dng",
+	".erf",
+	".iiq",
+	".kdc",
+	".mrw",
+	".nef",
+	".nrw",
+	".orf",
+	".pef",
+	".raf",
+	".rw2",
+	".rwl",
+	".sr2",
+	".srf",
+	".srw",
+	".x3f",
+}
+
+// Returns whether ext is the extension of a camera RAW format, like ".cr2".
+func IsRaw(ext string) bool {
+	return slices.Contains(rawExts, strings.ToLower(ext))
+}
+
+// QuickTime date tags, which are stored in UTC.
+var quickTimeDateTagNames = []string{
+	"QuickTime:CreateDate",
+	"QuickTime:ModifyDate",
+	"QuickTime:TrackCreateDate",
+	"QuickTime:TrackModifyDate",
+	"QuickTime:MediaCreateDate",
+	"QuickTime:MediaModifyDate",
+}
+
+// The exiftool format for EXIF and QuickTime date values, which don't include an
+// offset.
+const goExifToolWriteDateFmt = "2006:01:02 15:04:05"
+
+// Returns the write format for a file with ext, falling back to EXIF for images and
+// QuickTime for videos.
+func getWriteFormat(ext string, mediaKind types.MediaKind) writeFormat {
+	format, exists := writeFormats[strings.ToLower(ext)]
+	if exists {
+		return format
+	}
+	if mediaKind == types.Video {
+		return writeFormatQuickTime
+	}
+
+	return writeFormatExif
+}
+
+// Returns the arguments for exiftool to write date to every date tag in format.
+// Wall-clock dates are written with their offset, where the tag supports one, if
+// hasZone.
+func getDateArgs(date time.Time, hasZone bool, format writeFormat) []string {
+	local := date.Format(goExifToolWriteDateFmt)
+	localWithOffset := local
+	if hasZone {
+		localWithOffset += date.Format(utils.GoOffsetFmt)
+	}
+
+	args := []string{
+		fmt.Sprintf("-XMP-exif:DateTimeOriginal=%s", localWithOffset),
+		fmt.Sprintf("-XMP-xmp:CreateDate=%s", localWithOffset),
+		fmt.Sprintf("-XMP-xmp:ModifyDate=%s", localWithOffset),
+		fmt.Sprintf("-XMP-photoshop:DateCreated=%s", localWithOffset),
+	}
+
+	if format.Exif {
+		args = append(args,
+			fmt.Sprintf("-EXIF:DateTimeOriginal=%s", local),
+			fmt.Sprintf("-EXIF:CreateDate=%s", local),
+			fmt.Sprintf("-EXIF:ModifyDate=%s", local),
+		)
+		if hasZone {
+			offset := date.Format(utils.GoOffsetFmt)
+			args = append(args,
+				fmt.Sprintf("-EXIF:OffsetTime=%s", offset),
+				fmt.Sprintf("-EXIF:OffsetTimeOriginal=%s", offset),
+				fmt.Sprintf("-EXIF:OffsetTimeDigitized=%s", offset),
+			)
+		}
+	}
+
+	if format.PNG {
+		args = append(args, fmt.Sprintf("-PNG:CreationTime=%s", localWithOffset))
+	}
+
+	// QuickTime dates are UTC by definition, while Apple's Keys:CreationDate holds
+	// the local date with its offset.
+	if format.QuickTime {
+		utc := date.UTC().Format(goExifToolWriteDateFmt)
+		for _, n := range quickTimeDateTagNames {
+			args = append(args, fmt.Sprintf("-%s=%s", n, utc))
+		}
+		args = append(args, fmt.Sprintf("-Keys:CreationDate=%s", date.Format(goExifToolWriteDateFmt+utils.GoOffsetFmt)))
+	}
+
+	return args
+}
+
+// Reads format's verification tag from the file at path, and returns an error if it
+// doesn't hold date.
+func verifyDate(path string, date time.Time, format writeFormat) error {
+	out, err := exec.Command(lib.ExiftoolBin, "-"+format.VerifyTag, "-j", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error reading back %s: %s, %s", format.VerifyTag, err, string(out))
+	}
+
+	var v string
+	for _, t := range parseJSONResponse(out) {
+		v = fmt.Sprint(t)
+	}
+	if v == "" {
+		return fmt.Errorf("%s was not written", format.VerifyTag)
+	}
+
+	readDate, _, err := utils.ParseExifDate(v)
+	if err != nil {
+		return fmt.Errorf("%s reads back as '%s': %s", format.VerifyTag, v, err)
+	}
+
+	expected := date
+	if strings.HasPrefix(format.VerifyTag, "QuickTime:") {
+		expected = date.UTC()
+	}
+	expectedStr := expected.Format(goExifToolWriteDateFmt)
+	if readDate.Format(goExifToolWriteDateFmt) != expectedStr {
+		return fmt.Errorf("%s reads back as '%s', instead of '%s'", format.VerifyTag, v, expectedStr)
+	}
+
+	return nil
+}
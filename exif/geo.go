@@ -0,0 +1,190 @@
+package exif
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"porte/types"
+)
+
+// Returns the location described by the tags in geo, if it has a latitude and
+// longitude, marked as read from src. Coordinates are read from the GPS tags, or
+// from a QuickTime GPSCoordinates tag.
+func GetGeoLocation(geo map[string]types.ExifStrTag, src string) (types.GeoLocation, bool) {
+	loc := types.GeoLocation{Src: src}
+
+	lat, lon, ok := GetLatLon(geo)
+	if ok {
+		loc.Lat = lat
+		loc.Lon = lon
+		loc.Alt, loc.HasAlt = parseAlt(geo["GPSAltitude"].Value, geo["GPSAltitudeRef"].Value)
+	} else {
+		// QuickTime stores coordinates in one tag, like "33.86 S, 151.21 E, 10 m".
+		parts := strings.Split(geo["GPSCoordinates"].Value, ",")
+		if len(parts) < 2 {
+			return types.GeoLocation{}, false
+		}
+
+		var latOk, lonOk bool
+		loc.Lat, latOk = parseCoord(parts[0], "", "S")
+		loc.Lon, lonOk = parseCoord(parts[1], "", "W")
+		if !latOk || !lonOk {
+			return types.GeoLocation{}, false
+		}
+		if len(parts) > 2 {
+			loc.Alt, loc.HasAlt = parseAlt(parts[2], "")
+		}
+	}
+
+	fields := strings.Fields(geo["GPSHPositioningError"].Value)
+	if len(fields) > 0 {
+		precision, err := strconv.ParseFloat(fields[0], 64)
+		if err == nil {
+			loc.PrecisionM = precision
+		}
+	}
+
+	return loc, true
+}
+
+// Returns the arguments for exiftool to write loc to every GPS tag group in format:
+// XMP, along with EXIF or QuickTime if supported.
+func getGeoArgs(loc types.GeoLocation, format writeFormat) []string {
+	latRef, lonRef, altRef := "N", "E", "0"
+	if loc.Lat < 0 {
+		latRef = "S"
+	}
+	if loc.Lon < 0 {
+		lonRef = "W"
+	}
+	if loc.Alt < 0 {
+		altRef = "1"
+	}
+
+	args := []string{}
+
+	// EXIF stores unsigned values with separate hemisphere and altitude references.
+	// The # suffix writes a value as is, without converting it from a printed form.
+	if format.Exif {
+		args = append(args,
+			fmt.Sprintf("-GPS:GPSLatitude#=%s", formatCoord(abs(loc.Lat))),
+			fmt.Sprintf("-GPS:GPSLatitudeRef#=%s", latRef),
+			fmt.Sprintf("-GPS:GPSLongitude#=%s", formatCoord(abs(loc.Lon))),
+			fmt.Sprintf("-GPS:GPSLongitudeRef#=%s", lonRef),
+		)
+		if loc.HasAlt {
+			args = append(args,
+				fmt.Sprintf("-GPS:GPSAltitude#=%s", formatAlt(abs(loc.Alt))),
+				fmt.Sprintf("-GPS:GPSAltitudeRef#=%s", altRef),
+			)
+		}
+		if loc.PrecisionM > 0 {
+			args = append(args, fmt.Sprintf("-GPS:GPSHPositioningError#=%s", formatAlt(loc.PrecisionM)))
+		}
+	}
+
+	args = append(args, getXmpGeoArgs(loc)...)
+
+	// QuickTime stores signed values in one ISO 6709 string.
+	if format.QuickTime {
+		coords := fmt.Sprintf("%s, %s", formatCoord(loc.Lat), formatCoord(loc.Lon))
+		if loc.HasAlt {
+			coords += ", " + formatAlt(loc.Alt)
+		}
+		args = append(args, fmt.Sprintf("-Keys:GPSCoordinates=%s", coords))
+	}
+
+	return args
+}
+
+// Returns the arguments for exiftool to write loc to the XMP GPS tags. XMP stores
+// each coordinate's hemisphere in its value, which exiftool derives from the sign,
+// and the altitude with a separate reference.
+func getXmpGeoArgs(loc types.GeoLocation) []string {
+	args := []string{
+		fmt.Sprintf("-XMP-exif:GPSLatitude=%s", formatCoord(loc.Lat)),
+		fmt.Sprintf("-XMP-exif:GPSLongitude=%s", formatCoord(loc.Lon)),
+	}
+	if loc.HasAlt {
+		altRef := "0"
+		if loc.Alt < 0 {
+			altRef = "1"
+		}
+		args = append(args,
+			fmt.Sprintf("-XMP-exif:GPSAltitude#=%s", formatAlt(abs(loc.Alt))),
+			fmt.Sprintf("-XMP-exif:GPSAltitudeRef#=%s", altRef),
+		)
+	}
+
+	return args
+}
+
+// Returns the signed latitude and longitude described by the tags in geo, if both
+// exist. Values may be signed, or unsigned with a hemisphere in the value or in a
+// separate reference tag.
+func GetLatLon(geo map[string]types.ExifStrTag) (lat float64, lon float64, ok bool) {
+	lat, latOk := parseCoord(geo["GPSLatitude"].Value, geo["GPSLatitudeRef"].Value, "S")
+	lon, lonOk := parseCoord(geo["GPSLongitude"].Value, geo["GPSLongitudeRef"].Value, "W")
+	if !latOk || !lonOk {
+		return 0, 0, false
+	}
+
+	return lat, lon, true
+}
+
+func parseCoord(value string, ref string, negRef string) (float64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	if len(fields) > 1 {
+		ref = fields[1]
+	}
+	if strings.HasPrefix(strings.ToUpper(ref), negRef) && f > 0 {
+		f = -f
+	}
+
+	return f, true
+}
+
+// Parses an altitude in meters, like "12.5", "12.5 m", or "12.5 m Below Sea
+// Level", with ref either "Below Sea Level" or "1" for a negative altitude.
+func parseAlt(value string, ref string) (float64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	if strings.Contains(strings.ToLower(value), "below") || strings.HasPrefix(strings.ToLower(ref), "below") || ref == "1" {
+		f = -abs(f)
+	}
+
+	return f, true
+}
+
+func formatCoord(f float64) string {
+	return strconv.FormatFloat(f, 'f', 6, 64)
+}
+
+func formatAlt(f float64) string {
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
@@ -3,7 +3,8 @@ module porte
 go 1.19
 
 require (
-	golang.org/x/exp v0.0.0-20220916125017-b168a2c6b86b
+	github.com/ringsaturn/tzf v0.13.0
+	golang.org/x/exp v0.0.0-20221031165847-c99f073a8326
 	golang.org/x/term v0.21.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -14,9 +15,18 @@ require (
 	github.com/hablullah/go-juliandays v1.0.0 // indirect
 	github.com/jalaali/go-jalaali v0.0.0-20210801064154-80525e88d958 // indirect
 	github.com/magefile/mage v1.14.0 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/paulmach/orb v0.9.0 // indirect
+	github.com/ringsaturn/tzf-rel v0.0.2023-b // indirect
 	github.com/tetratelabs/wazero v1.2.1 // indirect
+	github.com/tidwall/geoindex v1.7.0 // indirect
+	github.com/tidwall/geojson v1.4.3 // indirect
+	github.com/tidwall/rtree v1.10.0 // indirect
+	github.com/twpayne/go-polyline v1.1.1 // indirect
 	github.com/wasilibs/go-re2 v1.3.0 // indirect
+	go.mongodb.org/mongo-driver v1.11.3 // indirect
 	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
 )
 
 require (
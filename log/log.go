@@ -1,42 +1,144 @@
 package log
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"porte/types"
 )
 
-type LogOutput struct {
-	Entries []LogEntry
+// The version of the record layout written to the streaming log. Increment this
+// whenever a change to Record, LogEntry, or Summary would break existing readers.
+const SchemaVersion = 4
+
+type RecordKind = string
+
+const (
+	RecordKindHeader  RecordKind = "header"
+	RecordKindEntry   RecordKind = "entry"
+	RecordKindSummary RecordKind = "summary"
+)
+
+// A single line in the streaming log. Exactly one of Header, Entry, or Summary is
+// set, according to Kind.
+type Record struct {
+	Kind    RecordKind
+	Header  *Header         `json:",omitempty"`
+	Entry   *PrettyLogEntry `json:",omitempty"`
+	Summary *Summary        `json:",omitempty"`
+}
+
+type Header struct {
+	SchemaVersion int
+	StartedAt     time.Time
+}
+
+type Summary struct {
+	StartedAt     time.Time
+	EndedAt       time.Time
+	DurationSec   float32
+	EntryCt       int
+	OutcomeCts    map[types.Outcome]int
+	FailCts       map[ErrCode]int
+	FileClassCts  map[types.FileClass]int
+	GeoConflictCt int
 }
 
 type DateSrc = string
 
 const (
-	DateSrcExifTag  DateSrc = "exifTag"
-	DateSrcImgTitle DateSrc = "fileName"
+	DateSrcExifTag   DateSrc = "exifTag"
+	DateSrcSupplFile DateSrc = "supplFile"
+	DateSrcImgTitle  DateSrc = "fileName"
+	DateSrcNeighbors DateSrc = "neighbors"
+	DateSrcFolder    DateSrc = "folder"
 )
 
+type ErrCode = string
+
+const (
+	ErrCodeAnalyze    ErrCode = "analyze"
+	ErrCodeNoDate     ErrCode = "no_date"
+	ErrCodeExifRead   ErrCode = "exif_read"
+	ErrCodeExifWrite  ErrCode = "exif_write"
+	ErrCodeSupplRead  ErrCode = "suppl_read"
+	ErrCodeVideoRemux ErrCode = "video_remux"
+	ErrCodeCopy       ErrCode = "copy"
+	ErrCodeThumbnail  ErrCode = "thumbnail"
+	ErrCodeSidecar    ErrCode = "sidecar"
+)
+
+type LogError struct {
+	Code    ErrCode
+	Message string
+}
+
 type LogEntry struct {
 	SrcPath                  string
 	DestPath                 string
+	SidecarPath              string
+	PairDestPath             string
+	OriginalDestPath         string
+	TranscodeExpectedSec     float32
+	TranscodeDurationSec     float32
+	TranscodeStreamDecisions []types.StreamDecision
 	SupplFilePath            string
 	Outcome                  types.Outcome
 	ConvertingStartedAt      time.Time
 	ConvertingEndedAt        time.Time
 	ConvertingDurationSec    float32
 	MediaKind                types.MediaKind
+	FileClass                types.FileClass
 	DateSrc                  DateSrc
 	DateSrcExifTagName       string
 	DateSrcImgTitleSearchStr string
+	DateSrcImgTitleMatch     string
+	DateSrcImgTitlePattern   string
+	DateSrcImgTitlePrecision string
+	DateSrcImgTitleLanguage  string
+	DateSrcNeighborPaths     []string
+	DateSrcFolderName        string
+	DateSrcFolderPrecision   string
+	DateConfidence           types.DateConfidence
 	UsedDateTag              types.ExifDateTag
+	TimeZone                 string
+	DateCandidates           []types.DateCandidate
+	UsedDescription          string
+	People                   []string
+	Flags                    []types.Flag
+	UsedGeo                  *types.GeoLocation
+	GeoCandidates            []types.GeoCandidate
+	GeoConflict              bool
 	AllExifTags              types.ExifTags
 	SupplExifTags            types.ExifTags
 	VidInfo                  types.VidInfo
-	Errors                   []string
+	SkipRule                 string
+	FailReason               ErrCode
+	Errors                   []LogError
+}
+
+// Records an error that doesn't prevent the file from being saved.
+func (e *LogEntry) AddError(code ErrCode, msg string) {
+	e.Errors = append(e.Errors, LogError{Code: code, Message: msg})
+}
+
+// Records an error that prevents the file from being saved. The first such error
+// determines the reason the file failed.
+func (e *LogEntry) AddFailure(code ErrCode, msg string) {
+	e.AddError(code, msg)
+	if e.FailReason == "" {
+		e.FailReason = code
+	}
+}
+
+// Returns whether an error has prevented the file from being saved.
+func (e *LogEntry) HasFailed() bool {
+	return e.FailReason != ""
 }
 
 type PrettyLogEntry struct {
@@ -46,64 +148,211 @@ type PrettyLogEntry struct {
 }
 
 var (
+	mu          sync.Mutex
 	outFilePath string
-	output      LogOutput
+	outFile     *os.File
+	summary     Summary
 )
 
-func Start(dir string) string {
-	outFilePath = filepath.Join(dir, "log.json")
-	output = LogOutput{}
-	return outFilePath
+// Creates a streaming JSON Lines log in dir and writes its header record. Returns
+// the path to the log file.
+func Start(dir string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	outFilePath = filepath.Join(dir, "log.jsonl")
+	f, err := os.OpenFile(outFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	outFile = f
+
+	summary = Summary{
+		StartedAt:    time.Now(),
+		OutcomeCts:   map[types.Outcome]int{},
+		FailCts:      map[ErrCode]int{},
+		FileClassCts: map[types.FileClass]int{},
+	}
+
+	header := Header{
+		SchemaVersion: SchemaVersion,
+		StartedAt:     summary.StartedAt,
+	}
+	err = writeRecord(Record{Kind: RecordKindHeader, Header: &header})
+	if err != nil {
+		return "", err
+	}
+
+	return outFilePath, nil
 }
 
-func AddEntry(entry LogEntry) {
-	output.Entries = append(output.Entries, entry)
-	write()
+// Appends entry to the log. The entry is flushed to disk before returning, so the
+// log remains usable if the run is interrupted.
+func AddEntry(entry LogEntry) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	summary.EntryCt++
+	summary.OutcomeCts[entry.Outcome]++
+	if entry.HasFailed() {
+		summary.FailCts[entry.FailReason]++
+	}
+	summary.FileClassCts[entry.FileClass]++
+	if entry.GeoConflict {
+		summary.GeoConflictCt++
+	}
+
+	prettyEntry := newPrettyLogEntry(entry)
+	return writeRecord(Record{Kind: RecordKindEntry, Entry: &prettyEntry})
 }
 
-func write() error {
-	prettyEntries := []PrettyLogEntry{}
-	for _, e := range output.Entries {
-		allExifTags := map[string]any{}
-		for n, t := range e.AllExifTags.Misc {
-			allExifTags[n] = t.Value
-		}
-		for n, t := range e.AllExifTags.Dates {
-			allExifTags[n] = t.Date
+// Writes the summary record and closes the log.
+func Finish() (Summary, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if outFile == nil {
+		return Summary{}, errors.New("log has not been started")
+	}
+
+	summary.EndedAt = time.Now()
+	summary.DurationSec = float32(summary.EndedAt.Sub(summary.StartedAt).Seconds())
+
+	err := writeRecord(Record{Kind: RecordKindSummary, Summary: &summary})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	err = outFile.Close()
+	outFile = nil
+	if err != nil {
+		return Summary{}, err
+	}
+
+	return summary, nil
+}
+
+// Reads the streaming log at path and calls fn with each record in order.
+func ReadRecords(path string, fn func(record Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
 		}
-		for n, t := range e.AllExifTags.Geo {
-			allExifTags[n] = t.Value
+
+		var record Record
+		err = json.Unmarshal(line, &record)
+		if err != nil {
+			return err
 		}
 
-		supplExifTags := map[string]any{}
-		for n, t := range e.SupplExifTags.Misc {
-			supplExifTags[n] = t.Value
+		err = fn(record)
+		if err != nil {
+			return err
 		}
-		for n, t := range e.SupplExifTags.Dates {
-			supplExifTags[n] = t.Date
+	}
+
+	return scanner.Err()
+}
+
+// Converts the streaming log at srcPath into a single indented JSON array of
+// entries at destPath, matching the layout of the original log.json.
+func WritePretty(srcPath string, destPath string) error {
+	f, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	_, _ = w.WriteString("[")
+
+	entryCt := 0
+	err = ReadRecords(srcPath, func(record Record) error {
+		if record.Kind != RecordKindEntry || record.Entry == nil {
+			return nil
 		}
-		for n, t := range e.SupplExifTags.Geo {
-			supplExifTags[n] = t.Value
+
+		bt, err := json.MarshalIndent(record.Entry, "  ", "  ")
+		if err != nil {
+			return err
 		}
 
-		prettyEntry := PrettyLogEntry{
-			LogEntry:      e,
-			AllExifTags:   allExifTags,
-			SupplExifTags: supplExifTags,
+		if entryCt > 0 {
+			_, _ = w.WriteString(",")
 		}
-		prettyEntries = append(prettyEntries, prettyEntry)
+		_, _ = w.WriteString("\n  ")
+		_, _ = w.Write(bt)
+		entryCt++
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	bt, err := json.MarshalIndent(prettyEntries, "", "  ")
+	if entryCt > 0 {
+		_, _ = w.WriteString("\n")
+	}
+	_, _ = w.WriteString("]")
+
+	return w.Flush()
+}
+
+func writeRecord(record Record) error {
+	if outFile == nil {
+		return errors.New("log has not been started")
+	}
+
+	bt, err := json.Marshal(record)
 	if err != nil {
 		return err
 	}
 
-	outPath := filepath.Join(outFilePath)
-	err = os.WriteFile(outPath, bt, 0644)
+	_, err = outFile.Write(append(bt, '\n'))
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return outFile.Sync()
+}
+
+func newPrettyLogEntry(e LogEntry) PrettyLogEntry {
+	allExifTags := map[string]any{}
+	for n, t := range e.AllExifTags.Misc {
+		allExifTags[n] = t.Value
+	}
+	for n, t := range e.AllExifTags.Dates {
+		allExifTags[n] = t.Date
+	}
+	for n, t := range e.AllExifTags.Geo {
+		allExifTags[n] = t.Value
+	}
+
+	supplExifTags := map[string]any{}
+	for n, t := range e.SupplExifTags.Misc {
+		supplExifTags[n] = t.Value
+	}
+	for n, t := range e.SupplExifTags.Dates {
+		supplExifTags[n] = t.Date
+	}
+	for n, t := range e.SupplExifTags.Geo {
+		supplExifTags[n] = t.Value
+	}
+	for n, t := range e.SupplExifTags.GeoExif {
+		supplExifTags["geoDataExif:"+n] = t.Value
+	}
+
+	return PrettyLogEntry{
+		LogEntry:      e,
+		AllExifTags:   allExifTags,
+		SupplExifTags: supplExifTags,
+	}
 }
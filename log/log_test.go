@@ -0,0 +1,91 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"porte/types"
+)
+
+func TestStreamingLog(t *testing.T) {
+	dir := t.TempDir()
+
+	logFilePath, err := Start(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []LogEntry{
+		{SrcPath: "/src/a.jpg", Outcome: types.OutcomeSuccess},
+		{SrcPath: "/src/b.jpg", Outcome: types.OutcomeFail, FailReason: ErrCodeNoDate, Errors: []LogError{{Code: ErrCodeNoDate, Message: "No date"}}},
+		{SrcPath: "/src/c.jpg", Outcome: types.OutcomeSuccess},
+	}
+	for _, e := range entries {
+		err = AddEntry(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.EntryCt != len(entries) {
+		t.Fatalf("Expected %d entries in summary but got %d", len(entries), summary.EntryCt)
+	}
+	if summary.OutcomeCts[types.OutcomeSuccess] != 2 || summary.OutcomeCts[types.OutcomeFail] != 1 {
+		t.Fatalf("Unexpected outcome counts in summary: %v", summary.OutcomeCts)
+	}
+	if summary.FailCts[ErrCodeNoDate] != 1 {
+		t.Fatalf("Unexpected fail counts in summary: %v", summary.FailCts)
+	}
+
+	// Verify the record order in the streaming log.
+
+	kinds := []RecordKind{}
+	err = ReadRecords(logFilePath, func(record Record) error {
+		kinds = append(kinds, record.Kind)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedKinds := []RecordKind{RecordKindHeader, RecordKindEntry, RecordKindEntry, RecordKindEntry, RecordKindSummary}
+	if fmt.Sprint(kinds) != fmt.Sprint(expectedKinds) {
+		t.Fatalf("Expected records %v but got %v", expectedKinds, kinds)
+	}
+
+	// Verify the converted log is a plain array of entries.
+
+	prettyPath := filepath.Join(dir, "log.json")
+	err = WritePretty(logFilePath, prettyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bt, err := os.ReadFile(prettyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prettyEntries []PrettyLogEntry
+	err = json.Unmarshal(bt, &prettyEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prettyEntries) != len(entries) {
+		t.Fatalf("Expected %d entries in converted log but got %d", len(entries), len(prettyEntries))
+	}
+	for i, e := range prettyEntries {
+		if e.SrcPath != entries[i].SrcPath {
+			t.Fatalf("Expected entry %d to be '%s' but got '%s'", i, entries[i].SrcPath, e.SrcPath)
+		}
+	}
+
+	fmt.Printf("Converted %d entries to '%s'\n", len(prettyEntries), prettyPath)
+}
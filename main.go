@@ -1,21 +1,32 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"porte/config"
 	"porte/porte"
 )
 
 func main() {
-	srcDir, destDir, err := parseArgs(os.Args)
+	configPath := flag.String("config", "", "path to a yaml config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err)
+		return
+	}
+
+	srcDir, destDir, err := parseArgs(flag.Args())
 	if err != nil {
 		fmt.Printf("Error validating arguments: %s\n", err)
 		return
 	}
 
-	err = porte.Run(srcDir, destDir)
+	err = porte.Run(srcDir, destDir, cfg)
 	if err != nil {
 		fmt.Printf("Error converting directory: %s\n", err)
 		return
@@ -23,18 +34,18 @@ func main() {
 }
 
 func parseArgs(args []string) (srcDir string, destDir string, err error) {
-	if len(args) < 2 {
-		return "", "", fmt.Errorf("not enough arguments (expected `bin srcpath destpath`)")
+	if len(args) < 1 {
+		return "", "", fmt.Errorf("not enough arguments (expected `bin [-config path] srcpath destpath`)")
 	}
 
-	srcDir = args[1]
+	srcDir = args[0]
 	_, err = os.Stat(srcDir)
 	if err != nil {
 		return "", "", fmt.Errorf("'%s' does not appear to be a valid source directory", srcDir)
 	}
 
-	if len(args) == 3 {
-		destDir = args[2]
+	if len(args) == 2 {
+		destDir = args[1]
 	} else {
 		srcDirEnclosing, srcDirBase := filepath.Split(srcDir)
 		destDir = filepath.Join(srcDirEnclosing, fmt.Sprintf("%s_Export", srcDirBase))
@@ -10,18 +10,25 @@ import (
 	"time"
 
 	"porte/console"
+	"porte/exif"
 	"porte/types"
 	"porte/utils"
 )
 
 type AnalyzeDirResult struct {
 	ImgFileInfoMap   types.FileInfoMap
+	RawFileInfoMap   types.FileInfoMap
 	VidFileInfoMap   types.FileInfoMap
 	SupplFileInfoMap types.FileInfoMap
+	// Dot-prefixed files, which are skipped but still logged.
+	HiddenFileInfoMap types.FileInfoMap
+	// Languages indicated by localized folder names in the source directory.
+	DetectedLanguages []string
 }
 
 type AnalyzeFileJob struct {
-	Path string
+	Path   string
+	SrcDir string
 }
 
 type AnalyzeFileResult struct {
@@ -58,6 +65,7 @@ func analyzeDir(srcDir string) (AnalyzeDirResult, error) {
 	// Get a more precise list of usable files.
 
 	usableFilesMap := map[string]bool{}
+	hiddenFileInfoMap := types.FileInfoMap{}
 	_ = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -69,6 +77,19 @@ func analyzeDir(srcDir string) (AnalyzeDirResult, error) {
 
 		fileName := d.Name()
 		if strings.HasPrefix(fileName, ".") {
+			relPath, _ := filepath.Rel(srcDir, path)
+			fileInfo := types.FileInfo{
+				Path:      path,
+				RelPath:   relPath,
+				Name:      fileName,
+				MediaKind: types.Unknown,
+				FileClass: types.FileClassHidden,
+			}
+			info, err := d.Info()
+			if err == nil {
+				fileInfo.Size = info.Size()
+			}
+			hiddenFileInfoMap[path] = fileInfo
 			return nil
 		}
 
@@ -92,7 +113,8 @@ func analyzeDir(srcDir string) (AnalyzeDirResult, error) {
 	// Populate jobs.
 	for path := range usableFilesMap {
 		job := AnalyzeFileJob{
-			Path: path,
+			Path:   path,
+			SrcDir: srcDir,
 		}
 		jobs <- job
 	}
@@ -104,6 +126,9 @@ func analyzeDir(srcDir string) (AnalyzeDirResult, error) {
 	imgFileInfoMap := types.FileInfoMap{}
 	imgExtCtMap := types.ExtCtMap{}
 
+	rawFileInfoMap := types.FileInfoMap{}
+	rawExtCtMap := types.ExtCtMap{}
+
 	vidFileInfoMap := types.FileInfoMap{}
 	vidExtCtMap := types.ExtCtMap{}
 	vidTotalDurationSec := 0
@@ -119,15 +144,19 @@ func analyzeDir(srcDir string) (AnalyzeDirResult, error) {
 
 		// Add result to counter maps.
 
-		if result.MediaKind == types.Image {
+		if result.MediaKind == types.Image && exif.IsRaw(result.Ext) {
+			rawFileInfoMap[result.Path] = result.MediaFileInfo
+			rawExtCtMap[result.Ext]++
+		} else if result.MediaKind == types.Image {
 			imgFileInfoMap[result.Path] = result.MediaFileInfo
 			imgExtCtMap[result.Ext]++
 		} else if result.MediaKind == types.Video {
 			vidFileInfoMap[result.Path] = result.MediaFileInfo
 			vidExtCtMap[result.Ext]++
 			vidTotalDurationSec += int(result.MediaFileInfo.VidInfo.DurationSec)
+		} else {
+			supplFileInfoMap[result.Path] = result.SupplFileInfo
 		}
-		supplFileInfoMap[result.Path] = result.SupplFileInfo
 
 		// Tell us about it.
 
@@ -137,6 +166,12 @@ func analyzeDir(srcDir string) (AnalyzeDirResult, error) {
 			imgExtsDisp = fmt.Sprintf("(%s)", imgExtsSorted)
 		}
 
+		rawExtsSorted := utils.SortedListFromCt(rawExtCtMap)
+		rawExtsDisp := ""
+		if len(rawExtCtMap) > 0 {
+			rawExtsDisp = fmt.Sprintf("(%s)", rawExtsSorted)
+		}
+
 		vidExtsSorted := utils.SortedListFromCt(vidExtCtMap)
 		vidExtsDisp := ""
 		if len(vidExtCtMap) > 0 {
@@ -152,16 +187,59 @@ func analyzeDir(srcDir string) (AnalyzeDirResult, error) {
 		console.Update(console.PhaseAnalyzing, [][]string{
 			{"", fmt.Sprintf("- Analyzed %d/%d files", walkedFileCt, totalFileCt)},
 			{"", fmt.Sprintf("- Images: %d %s", len(imgFileInfoMap), imgExtsDisp)},
+			{"", fmt.Sprintf("- RAW images: %d %s", len(rawFileInfoMap), rawExtsDisp)},
 			{"", fmt.Sprintf("- Videos: %d %s %s", len(vidFileInfoMap), vidExtsDisp, vidTotalDurationDisp)},
-			{"", fmt.Sprintf("- Supplementary files: %d", len(supplFileInfoMap))},
+			{"", fmt.Sprintf("- Other files: %d", len(supplFileInfoMap))},
 			{"", "- " + console.GetElapsedStr(sectionStart) + " elapsed"},
 		})
 	}
 
+	// Classify every non-media file by whether it describes a media file.
+
+	classifyOtherFiles(supplFileInfoMap, imgFileInfoMap, rawFileInfoMap, vidFileInfoMap)
+
+	// Find the languages of any localized folder names.
+
+	relPaths := []string{}
+	for path := range usableFilesMap {
+		relPath, err := filepath.Rel(srcDir, path)
+		if err == nil {
+			relPaths = append(relPaths, relPath)
+		}
+	}
+
 	result := AnalyzeDirResult{
-		ImgFileInfoMap:   imgFileInfoMap,
-		VidFileInfoMap:   vidFileInfoMap,
-		SupplFileInfoMap: supplFileInfoMap,
+		ImgFileInfoMap:    imgFileInfoMap,
+		RawFileInfoMap:    rawFileInfoMap,
+		VidFileInfoMap:    vidFileInfoMap,
+		SupplFileInfoMap:  supplFileInfoMap,
+		HiddenFileInfoMap: hiddenFileInfoMap,
+		DetectedLanguages: detectLanguages(relPaths),
 	}
 	return result, nil
 }
+
+// Sets the file class of each file in supplFileInfoMap, based on whether it is a
+// metadata file and whether it belongs to a file in one of mediaFileInfoMaps.
+func classifyOtherFiles(supplFileInfoMap types.FileInfoMap, mediaFileInfoMaps ...types.FileInfoMap) {
+	matchedPaths := map[string]bool{}
+	for _, m := range mediaFileInfoMaps {
+		for path := range m {
+			supplPath, err := utils.GetSupplementaryFilePath(path, supplFileInfoMap)
+			if err == nil {
+				matchedPaths[supplPath] = true
+			}
+		}
+	}
+
+	for path, info := range supplFileInfoMap {
+		if matchedPaths[path] {
+			info.FileClass = types.FileClassMatchedMetadata
+		} else if info.AnalyzeErr == "" && strings.ToLower(filepath.Ext(path)) == ".json" {
+			info.FileClass = types.FileClassOrphanMetadata
+		} else {
+			info.FileClass = types.FileClassUnsupported
+		}
+		supplFileInfoMap[path] = info
+	}
+}
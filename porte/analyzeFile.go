@@ -1,6 +1,7 @@
 package porte
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -25,6 +26,17 @@ func analyzeFile(job AnalyzeFileJob) (result AnalyzeFileResult) {
 	ext := strings.ToLower(extOrig)
 	name := strings.TrimSuffix(nameOrig, extOrig) + ext
 
+	relPath, err := filepath.Rel(job.SrcDir, path)
+	if err != nil {
+		relPath = nameOrig
+	}
+
+	var size int64
+	stat, err := os.Stat(path)
+	if err == nil {
+		size = stat.Size()
+	}
+
 	var mediaKind types.MediaKind = types.Unknown
 	var mediaFileInfo types.FileInfo
 	var supplFileInfo types.FileInfo
@@ -36,34 +48,63 @@ func analyzeFile(job AnalyzeFileJob) (result AnalyzeFileResult) {
 		mediaKind = types.Video
 	}
 
+	// RAW formats are reported under various mime types, like "image/x-canon-cr2",
+	// "image/tiff", or "application/octet-stream", so they're recognized by
+	// extension.
+	if exif.IsRaw(ext) && mediaKind != types.Video {
+		mediaKind = types.Image
+	}
+
 	if mediaKind == types.Image {
 		mediaFileInfo = types.FileInfo{
 			Path:      path,
+			RelPath:   relPath,
 			Name:      name,
+			Size:      size,
 			MediaKind: mediaKind,
+			FileClass: types.FileClassMedia,
 			MIMEType:  mimeType,
 		}
 	} else if mediaKind == types.Video {
 		vidInfo, err := encode.GetVidInfo(path)
 		if err != nil {
+			// Keep track of the unreadable video as an unsupported file.
+			supplFileInfo = types.FileInfo{
+				Path:       path,
+				RelPath:    relPath,
+				Name:       name,
+				Size:       size,
+				MediaKind:  types.Unknown,
+				MIMEType:   mimeType,
+				AnalyzeErr: err.Error(),
+			}
 			result := AnalyzeFileResult{
-				Path: path,
-				Err:  err,
+				Path:          path,
+				MediaKind:     types.Unknown,
+				SupplFileInfo: supplFileInfo,
+				Ext:           ext,
+				Err:           err,
 			}
 			return result
 		}
 		mediaFileInfo = types.FileInfo{
 			Path:      path,
+			RelPath:   relPath,
 			Name:      name,
+			Size:      size,
 			MediaKind: mediaKind,
+			FileClass: types.FileClassMedia,
 			MIMEType:  mimeType,
 			VidInfo:   vidInfo,
 		}
 	} else {
 		supplFileInfo = types.FileInfo{
 			Path:      path,
+			RelPath:   relPath,
 			Name:      name,
+			Size:      size,
 			MediaKind: mediaKind,
+			MIMEType:  mimeType,
 		}
 	}
 
@@ -3,12 +3,18 @@ package porte
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"time"
 
+	"porte/config"
 	"porte/console"
+	"porte/encode"
+	"porte/exif"
 	"porte/log"
 	"porte/types"
+	"porte/utils"
 )
 
 type ConvertFileJob struct {
@@ -16,32 +22,52 @@ type ConvertFileJob struct {
 	FileInfo         types.FileInfo
 	SupplFileInfoMap types.FileInfoMap
 	DestSubDirs      ConvertDestSubDirs
+	Config           config.Config
+	// Return a file without a date undated, instead of failing it, so that its date
+	// can be inferred once its neighbors are converted.
+	DeferUndated bool
+	// If set, a file without a date is given one estimated from its neighbors.
+	NeighborDates *sequenceIndex
+	// The destination of the image paired with a RAW file, like IMG_0001.JPG for
+	// IMG_0001.CR2, which the RAW file is saved next to under the same name.
+	PairDestPath string
 }
 
 type ConvertFileResult struct {
 	SrcPath  string
 	LogEntry log.LogEntry
 	Err      error
+	// Whether the file was left unconverted for lack of a date. See DeferUndated.
+	Deferred bool
 }
 
 type ConvertDestSubDirs struct {
 	Tmp     string
+	Thumbs  string
 	Success string
+	Review  string
 	Fail    string
+	Other   string
 }
 
-func convertDir(srcInfo AnalyzeDirResult, destDir string, logFilePath string, totalStart time.Time) error {
+func convertDir(srcInfo AnalyzeDirResult, destDir string, cfg config.Config) error {
 	// Set up destination directory structure.
 
 	destSubDirs := ConvertDestSubDirs{
 		Tmp:     filepath.Join(destDir, ".tmp"),
+		Thumbs:  filepath.Join(destDir, ".thumbs"),
 		Success: filepath.Join(destDir, "success"),
+		Review:  filepath.Join(destDir, "review"),
 		Fail:    filepath.Join(destDir, "fail"),
+		Other:   filepath.Join(destDir, "other"),
 	}
 
 	if err := os.MkdirAll(destSubDirs.Tmp, 0777); err != nil {
 		return err
 	}
+	if err := os.MkdirAll(destSubDirs.Thumbs, 0777); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(destSubDirs.Success, 0777); err != nil {
 		return err
 	}
@@ -51,50 +77,117 @@ func convertDir(srcInfo AnalyzeDirResult, destDir string, logFilePath string, to
 
 	defer os.RemoveAll(destSubDirs.Tmp)
 
-	// Convert all images and videos in the source directory.
+	// Convert all images and videos in the source directory, recording their dates
+	// for any files whose dates need to be inferred.
+
+	seqIdx := newSequenceIndex()
+	pairs := newRawPairIndex()
 
-	err := convertSubPhase(
+	deferredImgs, err := convertSubPhase(
 		srcInfo.ImgFileInfoMap,
 		srcInfo.SupplFileInfoMap,
 		destSubDirs,
+		cfg,
 		console.PhaseConvertingImgs,
+		seqIdx,
+		pairs,
+		false,
+	)
+	if err != nil {
+		return err
+	}
+
+	// RAW files are converted after images, so that each can be named after the
+	// image it was shot with.
+
+	deferredRaws, err := convertSubPhase(
+		srcInfo.RawFileInfoMap,
+		srcInfo.SupplFileInfoMap,
+		destSubDirs,
+		cfg,
+		console.PhaseConvertingRaws,
+		seqIdx,
+		pairs,
+		false,
 	)
 	if err != nil {
 		return err
 	}
 
-	err = convertSubPhase(
+	deferredVids, err := convertSubPhase(
 		srcInfo.VidFileInfoMap,
 		srcInfo.SupplFileInfoMap,
 		destSubDirs,
+		cfg,
 		console.PhaseConvertingVids,
+		seqIdx,
+		pairs,
+		false,
 	)
 	if err != nil {
 		return err
 	}
 
-	// Tell us about it.
+	// Convert files without dates, using dates inferred from their neighbors.
 
-	console.Update(console.PhaseComplete, [][]string{
-		{"", fmt.Sprintf("- Files exported to '%s'", destDir)},
-		{"", fmt.Sprintf("- Log saved to '%s'", logFilePath)},
-		{"", "- " + console.GetElapsedStr(totalStart) + " total elapsed"},
-	})
+	if cfg.Dates.InferFromNeighbors {
+		deferred := types.FileInfoMap{}
+		for path, fileInfo := range deferredImgs {
+			deferred[path] = fileInfo
+		}
+		for path, fileInfo := range deferredRaws {
+			deferred[path] = fileInfo
+		}
+		for path, fileInfo := range deferredVids {
+			deferred[path] = fileInfo
+		}
+
+		_, err = convertSubPhase(
+			deferred,
+			srcInfo.SupplFileInfoMap,
+			destSubDirs,
+			cfg,
+			console.PhaseInferringDates,
+			seqIdx,
+			pairs,
+			true,
+		)
+		if err != nil {
+			return err
+		}
+	} else {
+		console.Update(console.PhaseInferringDates, [][]string{
+			{"", "- Off"},
+		})
+	}
+
+	// Account for every file that isn't an image or video.
+
+	err = convertOtherFiles(srcInfo.SupplFileInfoMap, srcInfo.HiddenFileInfoMap, destSubDirs, cfg)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func convertSubPhase(mediaFileInfoMap types.FileInfoMap, supplFileInfoMap types.FileInfoMap, destSubDirs ConvertDestSubDirs, consolePhase int) error {
+// Converts each file in mediaFileInfoMap, recording the dates used in seqIdx and
+// the destinations of images in pairs, for naming RAW files after them. If
+// inferring, files are given dates estimated from seqIdx; otherwise, if configured,
+// undated files are left unconverted and returned, for inferring later.
+func convertSubPhase(mediaFileInfoMap types.FileInfoMap, supplFileInfoMap types.FileInfoMap, destSubDirs ConvertDestSubDirs, cfg config.Config, consolePhase int, seqIdx *sequenceIndex, pairs *rawPairIndex, inferring bool) (types.FileInfoMap, error) {
 	progressCt := 0
 	totalCt := len(mediaFileInfoMap)
 	successCt := 0
 	failCt := 0
+	skipCt := 0
+	deferred := types.FileInfoMap{}
 
 	if totalCt == 0 {
 		console.Update(consolePhase, [][]string{
 			{"", "- 0 files"},
 		})
-		return nil
+		return deferred, nil
 	}
 
 	// Set up worker pool to handle file analysis jobs.
@@ -110,17 +203,45 @@ func convertSubPhase(mediaFileInfoMap types.FileInfoMap, supplFileInfoMap types.
 	}
 	defer close(jobs)
 
-	// Populate jobs.
+	// Populate jobs. RAW files are held back until every other file has been
+	// converted, so that each can be named after the image it was shot with, even
+	// when both are converted together, as when inferring dates.
+	rawJobs := []ConvertFileJob{}
 	for path, fileInfo := range mediaFileInfoMap {
 		job := ConvertFileJob{
 			SrcPath:          path,
 			FileInfo:         fileInfo,
 			SupplFileInfoMap: supplFileInfoMap,
 			DestSubDirs:      destSubDirs,
+			Config:           cfg,
+			DeferUndated:     cfg.Dates.InferFromNeighbors && !inferring,
+		}
+		if inferring {
+			job.NeighborDates = seqIdx
+		}
+		if exif.IsRaw(filepath.Ext(path)) {
+			rawJobs = append(rawJobs, job)
+			continue
 		}
 		jobs <- job
 	}
 
+	// Estimate the time needed for any videos that will be transcoded, since it can
+	// far exceed the time needed for everything else.
+
+	transcodeCt := 0
+	var transcodeExpected time.Duration
+	if cfg.Transcode.Enabled {
+		for _, fileInfo := range mediaFileInfoMap {
+			if fileInfo.MediaKind == types.Video && encode.NeedsTranscode(fileInfo.VidInfo) {
+				transcodeCt++
+				transcodeExpected += encode.EstimateTranscodeDuration(fileInfo.VidInfo, cfg.Transcode)
+			}
+		}
+	}
+	transcodedCt := 0
+	var transcodeActual time.Duration
+
 	// Read results from file conversions.
 
 	sectionStart := time.Now()
@@ -130,23 +251,139 @@ func convertSubPhase(mediaFileInfoMap types.FileInfoMap, supplFileInfoMap types.
 	})
 
 	for i := 0; i < jobCt; i++ {
+		if i == jobCt-len(rawJobs) {
+			for _, job := range rawJobs {
+				job.PairDestPath = pairs.getDestPath(job.SrcPath)
+				jobs <- job
+			}
+		}
+
 		result := <-results
 		progressCt++
 
-		console.Update(consolePhase, [][]string{
+		if result.LogEntry.TranscodeDurationSec > 0 {
+			transcodedCt++
+			transcodeActual += time.Duration(float64(result.LogEntry.TranscodeDurationSec) * float64(time.Second))
+		}
+
+		rows := [][]string{
 			{"", fmt.Sprintf("- '%s'", result.SrcPath)},
 			{"", fmt.Sprintf("- Converting %d of %d", progressCt, totalCt)},
-			{"", fmt.Sprintf("- %d success, %d fail", successCt, failCt)},
-			{"", "- " + console.GetElapsedStr(sectionStart) + " elapsed"},
-		})
-		log.AddEntry(result.LogEntry)
+			{"", fmt.Sprintf("- %d success, %d fail, %d skip, %d deferred", successCt, failCt, skipCt, len(deferred))},
+		}
+		if transcodeCt > 0 {
+			rows = append(rows, []string{"", fmt.Sprintf("- Transcoded %d of %d videos in %s (expected about %s in total)", transcodedCt, transcodeCt, transcodeActual.Round(time.Second), transcodeExpected.Round(time.Second))})
+		}
+		rows = append(rows, []string{"", "- " + console.GetElapsedStr(sectionStart) + " elapsed"})
+		console.Update(consolePhase, rows)
+
+		if result.Deferred {
+			deferred[result.SrcPath] = mediaFileInfoMap[result.SrcPath]
+			continue
+		}
+
+		// Only dates read from a source are recorded, so that estimates aren't
+		// chained from other estimates.
+		if !inferring && !result.LogEntry.UsedDateTag.Date.IsZero() {
+			seqIdx.add(result.SrcPath, result.LogEntry.AllExifTags.Misc["Model"].Value, result.LogEntry.UsedDateTag.Date)
+		}
+
+		if result.LogEntry.Outcome == types.OutcomeSuccess && !exif.IsRaw(filepath.Ext(result.SrcPath)) {
+			pairs.add(result.SrcPath, result.LogEntry.DestPath)
+		}
+
+		err := log.AddEntry(result.LogEntry)
+		if err != nil {
+			return nil, err
+		}
 
 		if result.LogEntry.Outcome == types.OutcomeSuccess {
 			successCt++
 		} else if result.LogEntry.Outcome == types.OutcomeFail {
 			failCt++
+		} else if result.LogEntry.Outcome == types.OutcomeSkip {
+			skipCt++
+		}
+	}
+
+	return deferred, nil
+}
+
+// Logs each file in supplFileInfoMap with its file class, copying unsupported files
+// to the other directory if configured, and logs each file in hiddenFileInfoMap as
+// skipped.
+func convertOtherFiles(supplFileInfoMap types.FileInfoMap, hiddenFileInfoMap types.FileInfoMap, destSubDirs ConvertDestSubDirs, cfg config.Config) error {
+	paths := []string{}
+	for path := range supplFileInfoMap {
+		paths = append(paths, path)
+	}
+	for path := range hiddenFileInfoMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	classCtMap := map[types.FileClass]int{}
+	copiedCt := 0
+
+	for _, path := range paths {
+		fileInfo, exists := supplFileInfoMap[path]
+		if !exists {
+			fileInfo = hiddenFileInfoMap[path]
+		}
+
+		logEntry := log.LogEntry{}
+		absSrcPath, _ := filepath.Abs(path)
+		logEntry.SrcPath = absSrcPath
+		logEntry.MediaKind = fileInfo.MediaKind
+		logEntry.FileClass = fileInfo.FileClass
+		logEntry.Outcome = types.OutcomeOther
+		logEntry.ConvertingStartedAt = time.Now()
+
+		if fileInfo.FileClass == types.FileClassHidden {
+			logEntry.Outcome = types.OutcomeSkip
+			logEntry.SkipRule = "hidden: dot-prefixed file"
+		}
+
+		if fileInfo.AnalyzeErr != "" {
+			logEntry.AddError(log.ErrCodeAnalyze, fmt.Sprintf("Error analyzing file: %s", fileInfo.AnalyzeErr))
+		}
+
+		if fileInfo.FileClass == types.FileClassUnsupported && cfg.Other.CopyUnsupported {
+			err := os.MkdirAll(destSubDirs.Other, 0777)
+			if err != nil {
+				return err
+			}
+
+			copyToPath := utils.GetAvailableDestPath(destSubDirs.Other, filepath.Base(path))
+			out, err := exec.Command("cp", path, copyToPath).CombinedOutput()
+			if err != nil {
+				logEntry.AddError(log.ErrCodeCopy, fmt.Sprintf("Error copying file to other directory: %s, %s", err.Error(), string(out)))
+			} else {
+				absDestPath, _ := filepath.Abs(copyToPath)
+				logEntry.DestPath = absDestPath
+				copiedCt++
+			}
 		}
+
+		logEntry.ConvertingEndedAt = time.Now()
+		logEntry.ConvertingDurationSec = float32(logEntry.ConvertingEndedAt.Sub(logEntry.ConvertingStartedAt).Seconds())
+
+		err := log.AddEntry(logEntry)
+		if err != nil {
+			return err
+		}
+
+		classCtMap[fileInfo.FileClass]++
 	}
 
+	// Tell us about it.
+
+	console.Update(console.PhaseHandlingOther, [][]string{
+		{"", fmt.Sprintf("- Matched metadata: %d", classCtMap[types.FileClassMatchedMetadata])},
+		{"", fmt.Sprintf("- Orphan metadata: %d", classCtMap[types.FileClassOrphanMetadata])},
+		{"", fmt.Sprintf("- Unsupported: %d (%d copied)", classCtMap[types.FileClassUnsupported], copiedCt)},
+		{"", fmt.Sprintf("- Hidden: %d (skipped)", classCtMap[types.FileClassHidden])},
+	})
+
 	return nil
 }
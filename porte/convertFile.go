@@ -8,11 +8,15 @@ import (
 	"strings"
 	"time"
 
+	"porte/config"
 	"porte/encode"
 	"porte/exif"
 	"porte/log"
 	"porte/types"
+	"porte/tz"
 	"porte/utils"
+
+	"golang.org/x/exp/slices"
 )
 
 func runConvertFileJob(jobs <-chan ConvertFileJob, results chan<- ConvertFileResult) {
@@ -32,6 +36,7 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 	absSrcPath, _ := filepath.Abs(srcPath)
 	logEntry.SrcPath = absSrcPath
 	logEntry.MediaKind = fileInfo.MediaKind
+	logEntry.FileClass = fileInfo.FileClass
 	logEntry.ConvertingStartedAt = time.Now()
 
 	if fileInfo.MediaKind == types.Video {
@@ -44,12 +49,22 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 		result.LogEntry = logEntry
 	}()
 
-	canSaveFile := true
+	// Leave the file out if it matches a skip rule.
+
+	skipRule := getFileSkipRule(job.Config.Skip, fileInfo)
+	if skipRule != "" {
+		logEntry.Outcome = types.OutcomeSkip
+		logEntry.SkipRule = skipRule
+		return ConvertFileResult{SrcPath: srcPath, LogEntry: logEntry}
+	}
 
 	// Set up directory structure.
 
 	tmpWorkingDir, err := os.MkdirTemp(subDirs.Tmp, "")
 	if err != nil {
+		logEntry.AddFailure(log.ErrCodeCopy, fmt.Sprintf("Error creating working directory: %s", err))
+		saveFailedFile(srcPath, subDirs.Fail, &logEntry)
+
 		result := ConvertFileResult{
 			SrcPath:  srcPath,
 			LogEntry: logEntry,
@@ -69,7 +84,8 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 
 	exifTags, err := exif.GetAllExifTags(srcPath)
 	if err != nil {
-		logEntry.Errors = append(logEntry.Errors, fmt.Sprintf("Error getting all exif tags: %s", err))
+		logEntry.AddFailure(log.ErrCodeExifRead, fmt.Sprintf("Error getting all exif tags: %s", err))
+		saveFailedFile(srcPath, subDirs.Fail, &logEntry)
 
 		result := ConvertFileResult{
 			SrcPath:  srcPath,
@@ -80,73 +96,130 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 	}
 	logEntry.AllExifTags = exifTags
 
+	skipRule = getClassSkipRule(job.Config.Skip, fileInfo, exifTags)
+	if skipRule != "" {
+		logEntry.Outcome = types.OutcomeSkip
+		logEntry.SkipRule = skipRule
+		return ConvertFileResult{SrcPath: srcPath, LogEntry: logEntry}
+	}
+
 	// Extract all exif tags from a supplementary file, if available.
 
 	supplFilePath, supplExifTags, err := exif.GetSupplementaryExifTags(srcPath, supplFileInfoMap)
 	if err != nil {
-		logEntry.Errors = append(logEntry.Errors, fmt.Sprintf("Error getting supplementary exif tags: %s", err))
+		logEntry.AddError(log.ErrCodeSupplRead, fmt.Sprintf("Error getting supplementary exif tags: %s", err))
 	}
 	logEntry.SupplFilePath = supplFilePath
 	logEntry.SupplExifTags = supplExifTags
 
-	// Find the earliest available date tag.
+	// Handle the file as it was flagged in Google Photos.
 
-	earliestDateTag := types.ExifDateTag{
-		Name: "",
-		Date: time.Now(),
+	flags := getFlagHandling(job.Config.Flags, supplExifTags.Flags)
+	logEntry.Flags = supplExifTags.Flags
+	if flags.SkipRule != "" {
+		logEntry.Outcome = types.OutcomeSkip
+		logEntry.SkipRule = flags.SkipRule
+		return ConvertFileResult{SrcPath: srcPath, LogEntry: logEntry}
 	}
-	foundDate := false
-	dateTags := []types.ExifDateTag{}
-	for _, t := range exifTags.Dates {
-		dateTags = append(dateTags, t)
+
+	// Choose a location according to the configured source priority, recording any
+	// location that disagrees with it.
+
+	var geo *types.GeoLocation
+	geoWinner, geoCandidates, ok := selectGeo(getGeoCandidates(exifTags, supplExifTags), job.Config.Geo)
+	if ok {
+		geo = &geoWinner
 	}
-	for _, t := range supplExifTags.Dates {
-		dateTags = append(dateTags, t)
+	logEntry.UsedGeo = geo
+	logEntry.GeoCandidates = geoCandidates
+	for _, c := range geoCandidates {
+		logEntry.GeoConflict = logEntry.GeoConflict || c.Conflict
 	}
-	if len(dateTags) > 0 {
-		earliestDateTag = dateTags[0]
-		for _, t := range dateTags {
-			if t.Date.Before(earliestDateTag.Date) {
-				earliestDateTag = t
+
+	// Find the local time zone at the file's location, if known.
+
+	var loc *time.Location
+	if job.Config.Dates.InferTimeZone {
+		if geo != nil {
+			loc, err = tz.Lookup(geo.Lat, geo.Lon)
+			if err == nil {
+				logEntry.TimeZone = loc.String()
+			} else {
+				loc = nil
 			}
 		}
-		foundDate = true
-		logEntry.DateSrc = log.DateSrcExifTag
-		logEntry.DateSrcExifTagName = earliestDateTag.Name
 	}
 
-	if !foundDate {
-		searchStr := fileInfo.Name + " " + supplExifTags.Misc["ImageTitle"].Value
-		dateFromTitle, err := utils.GetDateFromStr(searchStr)
-		if err == nil {
-			// If the filename or image title indicates an earlier date than any other,
-			// use it. This could mean an older photo was digitized at a later date, causing
-			// the exif data to be incorrect.
-			earliestDateTag = types.ExifDateTag{
-				Name: "CreateDate",
-				Date: dateFromTitle,
-			}
-			foundDate = true
+	// Choose a date according to the configured source priority, comparing dates
+	// as instants. Wall-clock dates without a zone are assumed to be in the local
+	// time zone, if known, or otherwise in UTC.
+
+	dateCandidates, fileNameSearchStr, strDates := getDateCandidates(fileInfo, exifTags, supplExifTags, loc, job.Config.Dates.Languages)
+	rejectImplausibleDates(dateCandidates, job.Config.Dates.Plausibility, exifTags.Misc["Model"].Value, time.Now())
+	dateWinner, dateCandidates, foundDate := selectDate(dateCandidates, job.Config.Dates.Priority)
+	logEntry.DateCandidates = dateCandidates
+
+	dateTag := dateWinner.Tag
+	if foundDate {
+		if dateWinner.Src == config.DateSrcFileName {
+			fileNameDate := strDates[config.DateSrcFileName]
 			logEntry.DateSrc = log.DateSrcImgTitle
-			logEntry.DateSrcImgTitleSearchStr = searchStr
+			logEntry.DateSrcImgTitleSearchStr = fileNameSearchStr
+			logEntry.DateSrcImgTitleMatch = fileNameDate.Match
+			logEntry.DateSrcImgTitlePattern = fileNameDate.Pattern
+			logEntry.DateSrcImgTitlePrecision = fileNameDate.Precision
+			logEntry.DateSrcImgTitleLanguage = fileNameDate.Language
+		} else if dateWinner.Src == config.DateSrcFolder {
+			folderDate := strDates[config.DateSrcFolder]
+			logEntry.DateSrc = log.DateSrcFolder
+			logEntry.DateSrcFolderName = folderDate.Match
+			logEntry.DateSrcFolderPrecision = folderDate.Precision
+		} else if strings.HasPrefix(dateWinner.Src, config.DateSrcJSONPrefix) {
+			logEntry.DateSrc = log.DateSrcSupplFile
+			logEntry.DateSrcExifTagName = dateTag.Name
+		} else {
+			logEntry.DateSrc = log.DateSrcExifTag
+			logEntry.DateSrcExifTagName = dateTag.Name
 		}
 	}
 
-	if !foundDate {
-		canSaveFile = false
-		logEntry.Errors = append(logEntry.Errors, "No earliest date found in file, supplementary file, or filename")
-	} else {
-		logEntry.UsedDateTag = earliestDateTag
-	}
+	// Otherwise, estimate a date from the file's neighbors, if they're known, or
+	// leave the file until they are.
 
-	// Find all geo tags.
+	if !foundDate && job.NeighborDates != nil {
+		candidate, paths, ok := job.NeighborDates.estimate(srcPath, exifTags.Misc["Model"].Value, job.Config.Dates.MaxNeighborGap)
+		if ok {
+			dateTag = candidate.Tag
+			foundDate = true
+			logEntry.DateCandidates = append(logEntry.DateCandidates, candidate)
+			logEntry.DateSrc = log.DateSrcNeighbors
+			for _, p := range paths {
+				absPath, _ := filepath.Abs(p)
+				logEntry.DateSrcNeighborPaths = append(logEntry.DateSrcNeighborPaths, absPath)
+			}
+			logEntry.DateConfidence = candidate.Confidence
+		}
+	}
 
-	geoTags := []types.ExifStrTag{}
-	for _, t := range exifTags.Geo {
-		geoTags = append(geoTags, t)
+	if !foundDate && job.DeferUndated {
+		return ConvertFileResult{SrcPath: srcPath, LogEntry: logEntry, Deferred: true}
 	}
-	for _, t := range supplExifTags.Geo {
-		geoTags = append(geoTags, t)
+
+	if !foundDate {
+		logEntry.AddFailure(log.ErrCodeNoDate, "No plausible date found in file, supplementary file, or filename from a source in the priority list")
+	} else {
+		// Express the date as local wall-clock time for naming and writing.
+		if loc != nil {
+			dateTag.Date = dateTag.Date.In(loc)
+		}
+		logEntry.UsedDateTag = dateTag
+
+		skipRule = getDateSkipRule(job.Config.Skip, dateTag.Date)
+		if skipRule != "" {
+			logEntry.Outcome = types.OutcomeSkip
+			logEntry.SkipRule = skipRule
+			return ConvertFileResult{SrcPath: srcPath, LogEntry: logEntry}
+		}
 	}
 
 	// Set the input filename as the title tag to preserve it (since the output filename
@@ -154,12 +227,22 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 
 	title := srcName
 
+	// Carry a caption from the supplementary file into the file.
+
+	description := getDescription(job.Config.Metadata.DescriptionPolicy, exifTags, supplExifTags)
+	logEntry.UsedDescription = description
+
+	// Carry the names of people tagged in the supplementary file into the file.
+
+	logEntry.People = supplExifTags.People
+
 	// Copy from the source file to a temporary file to begin safely making modifications.
 
 	tmpPath := filepath.Join(tmpWorkingDir, "1") + srcExt
 	_, err = exec.Command("cp", srcPath, tmpPath).CombinedOutput()
 	if err != nil {
-		logEntry.Errors = append(logEntry.Errors, err.Error())
+		logEntry.AddFailure(log.ErrCodeCopy, fmt.Sprintf("Error copying file to working directory: %s", err))
+		saveFailedFile(srcPath, subDirs.Fail, &logEntry)
 
 		result := ConvertFileResult{
 			SrcPath:  srcPath,
@@ -178,7 +261,8 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 		tmpPathNext = filepath.Join(tmpWorkingDir, "2") + fixedExt
 		out, err := exec.Command("cp", tmpPath, tmpPathNext).CombinedOutput()
 		if err != nil {
-			logEntry.Errors = append(logEntry.Errors, fmt.Sprintf("Error copying file with new extension: %s", string(out)))
+			logEntry.AddFailure(log.ErrCodeCopy, fmt.Sprintf("Error copying file with new extension: %s", string(out)))
+			saveFailedFile(srcPath, subDirs.Fail, &logEntry)
 
 			result := ConvertFileResult{
 				SrcPath:  srcPath,
@@ -192,35 +276,91 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 		tmpPath = tmpPathNext
 	}
 
-	// Normalize a video by repackaging or copying.
+	// Normalize a video by transcoding, if configured and it can't be repackaged in
+	// mp4, or otherwise by repackaging or copying. A video that has already failed is
+	// saved as is, so neither is done.
 
 	tmpPathNext = ""
-	if fileInfo.MediaKind == types.Video {
-		tmpPathNext, err = encode.CopyVideo(fileInfo, tmpPath, tmpWorkingDir, "3")
+	vidMeta := encode.VidMetadata{
+		Title: title,
+		Date:  dateTag.Date,
+	}
+	transcoded := false
+	if fileInfo.MediaKind == types.Video && job.Config.Transcode.Enabled && encode.NeedsTranscode(fileInfo.VidInfo) && !logEntry.HasFailed() {
+		transcodeStart := time.Now()
+		logEntry.TranscodeExpectedSec = float32(encode.EstimateTranscodeDuration(fileInfo.VidInfo, job.Config.Transcode).Seconds())
+		var decisions []types.StreamDecision
+		tmpPathNext, decisions, err = encode.TranscodeVideo(fileInfo, tmpPath, tmpWorkingDir, "3", vidMeta, job.Config.Transcode)
 		if err != nil {
-			canSaveFile = false
-			logEntry.Errors = append(logEntry.Errors, fmt.Sprintf("Error copying or encoding video: %s", err))
+			logEntry.AddError(log.ErrCodeVideoRemux, fmt.Sprintf("Error transcoding video, repackaging instead: %s", err))
+		} else {
+			transcoded = true
+			logEntry.TranscodeDurationSec = float32(time.Since(transcodeStart).Seconds())
+			logEntry.TranscodeStreamDecisions = decisions
+		}
+	}
+	if fileInfo.MediaKind == types.Video && !transcoded && !logEntry.HasFailed() {
+		var remuxErrs []error
+		tmpPathNext, remuxErrs, err = encode.CopyVideo(fileInfo, tmpPath, tmpWorkingDir, "3", vidMeta)
+		for _, remuxErr := range remuxErrs {
+			logEntry.AddError(log.ErrCodeVideoRemux, remuxErr.Error())
+		}
+		if err != nil {
+			logEntry.AddFailure(log.ErrCodeVideoRemux, fmt.Sprintf("Error copying or encoding video: %s", err))
 		}
 	}
 	if tmpPathNext != "" {
 		tmpPath = tmpPathNext
 	}
 
-	// Set the file's tags.
+	// Set the file's tags, writing them to a sidecar instead for files that can't be
+	// safely written in place, or if configured or writing them into the file fails.
 
+	sidecarCfg := job.Config.Sidecar
+	sidecarNaming := sidecarCfg.Naming
+	sidecarNamingFellBack := false
+	if job.PairDestPath != "" {
+		sidecarNaming, sidecarNamingFellBack = getPairSidecarNaming(sidecarCfg.Naming, job.PairDestPath)
+	}
+	tmpSidecarPath := ""
 	tmpPathNext = ""
-	if canSaveFile {
+	if !logEntry.HasFailed() {
 		tmpPathNext = filepath.Join(tmpWorkingDir, "4"+filepath.Ext(tmpPath))
 		tagsArg := exif.SetExifTagsArg{
-			TagsPath: srcPath,
-			Title:    title,
-			Date:     earliestDateTag.Date,
-			Geo:      geoTags,
+			TagsPath:    srcPath,
+			MediaKind:   fileInfo.MediaKind,
+			Title:       title,
+			Description: description,
+			People:      supplExifTags.People,
+			Keywords:    flags.Keywords,
+			Rating:      flags.Rating,
+			Label:       flags.Label,
+			Date:        dateTag.Date,
+			HasZone:     dateTag.HasZone,
+			Geo:         geo,
+		}
+		ext := strings.ToLower(filepath.Ext(tmpPath))
+		useSidecar := sidecarCfg.Mode == config.SidecarModeAlways ||
+			(sidecarCfg.Mode == config.SidecarModeFallback && slices.Contains(sidecarCfg.Extensions, ext)) ||
+			(sidecarCfg.Mode != config.SidecarModeNever && sidecarCfg.Raw && exif.IsRaw(ext))
+		if useSidecar {
+			tagsArg.SidecarPath = exif.GetSidecarPath(tmpPathNext, sidecarNaming)
 		}
+
 		err = exif.SetExifTags(tmpPath, tmpPathNext, tagsArg)
+		if err != nil && !useSidecar && sidecarCfg.Mode == config.SidecarModeFallback {
+			logEntry.AddError(log.ErrCodeExifWrite, fmt.Sprintf("Error setting exif tags, writing a sidecar instead: %s", err))
+			os.Remove(tmpPathNext)
+			tagsArg.SidecarPath = exif.GetSidecarPath(tmpPathNext, sidecarNaming)
+			err = exif.SetExifTags(tmpPath, tmpPathNext, tagsArg)
+		}
 		if err != nil {
-			canSaveFile = false
-			logEntry.Errors = append(logEntry.Errors, fmt.Sprintf("Error setting exif tags: %s", err))
+			logEntry.AddFailure(log.ErrCodeExifWrite, fmt.Sprintf("Error setting exif tags: %s", err))
+		} else {
+			tmpSidecarPath = tagsArg.SidecarPath
+		}
+		if tmpSidecarPath != "" && sidecarNamingFellBack {
+			logEntry.AddError(log.ErrCodeSidecar, fmt.Sprintf("Paired image '%s' already has a Lightroom sidecar, so this one is named as darktable names them", filepath.Base(job.PairDestPath)))
 		}
 	}
 	if tmpPathNext != "" {
@@ -228,34 +368,86 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 	}
 
 	// Write the file to the success or fail directory with the appropriate name.
+	// Files dated only by a folder name can be set aside for review, and flagged
+	// files can be put in subdirectories. A RAW file paired with a JPEG is kept next
+	// to it, under the same name.
 
-	copyFromPath := ""
-	copyToPath := ""
-	outcome := types.OutcomeSuccess
+	successDir := subDirs.Success
+	if logEntry.DateSrc == log.DateSrcFolder && job.Config.Dates.ReviewFolderDates {
+		successDir = subDirs.Review
+	}
+	successDir = filepath.Join(append([]string{successDir}, flags.Subdirs...)...)
+	destFileNameNoExt := dateTag.Date.Format(utils.FileNameFmt) + utils.FileNamePartSep + srcName
+	if job.PairDestPath != "" {
+		successDir = filepath.Dir(job.PairDestPath)
+		destFileNameNoExt = strings.TrimSuffix(filepath.Base(job.PairDestPath), filepath.Ext(job.PairDestPath))
+		logEntry.PairDestPath = job.PairDestPath
+	}
 
-	if canSaveFile {
-		copyFromPath = tmpPath
-		destFileName := earliestDateTag.Date.Format(utils.FileNameFmt) + utils.FileNamePartSep + srcName + filepath.Ext(tmpPath)
-		copyToPath = utils.GetAvailableDestPath(subDirs.Success, destFileName)
-		outcome = types.OutcomeSuccess
-	} else {
-		copyFromPath = srcPath
-		destFileName := srcNameExt
-		copyToPath = utils.GetAvailableDestPath(subDirs.Fail, destFileName)
-		outcome = types.OutcomeFail
+	if !logEntry.HasFailed() {
+		err = os.MkdirAll(successDir, 0777)
+		if err != nil {
+			logEntry.AddFailure(log.ErrCodeCopy, fmt.Sprintf("Error creating final directory: %s", err))
+		}
 	}
 
-	cmd := exec.Command("cp", copyFromPath, copyToPath)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		logEntry.Errors = append(logEntry.Errors, fmt.Sprintf("Error copying file to final directory: %s, %s", err.Error(), string(out)))
+	if !logEntry.HasFailed() {
+		destFileName := destFileNameNoExt + filepath.Ext(tmpPath)
+		sidecarPath := func(path string) string {
+			return exif.GetSidecarPath(path, sidecarNaming)
+		}
+		copyToPath := utils.GetAvailableDestPathWithSidecar(successDir, destFileName, sidecarPath)
+
+		cmd := exec.Command("cp", tmpPath, copyToPath)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			logEntry.AddFailure(log.ErrCodeCopy, fmt.Sprintf("Error copying file to final directory: %s, %s", err.Error(), string(out)))
+		} else if tmpSidecarPath != "" {
+			out, err = exec.Command("cp", tmpSidecarPath, sidecarPath(copyToPath)).CombinedOutput()
+			if err != nil {
+				logEntry.AddFailure(log.ErrCodeCopy, fmt.Sprintf("Error copying sidecar to final directory: %s, %s", err.Error(), string(out)))
+				os.Remove(copyToPath)
+			} else {
+				absSidecarPath, _ := filepath.Abs(sidecarPath(copyToPath))
+				logEntry.SidecarPath = absSidecarPath
+			}
+		}
+
+		// Keep the original of a transcoded video next to it, if configured.
+		if !logEntry.HasFailed() && transcoded && job.Config.Transcode.KeepOriginal {
+			origPath := utils.GetAvailableDestPath(successDir, destFileNameNoExt+srcExt)
+			out, err = exec.Command("cp", srcPath, origPath).CombinedOutput()
+			if err != nil {
+				logEntry.AddFailure(log.ErrCodeCopy, fmt.Sprintf("Error copying original to final directory: %s, %s", err.Error(), string(out)))
+				os.Remove(copyToPath)
+				if tmpSidecarPath != "" {
+					os.Remove(sidecarPath(copyToPath))
+				}
+			} else {
+				absOrigPath, _ := filepath.Abs(origPath)
+				logEntry.OriginalDestPath = absOrigPath
+			}
+		}
+
+		if !logEntry.HasFailed() {
+			absDestPath, _ := filepath.Abs(copyToPath)
+			logEntry.DestPath = absDestPath
+			logEntry.Outcome = types.OutcomeSuccess
+		}
+	}
+
+	if logEntry.HasFailed() {
+		saveFailedFile(srcPath, subDirs.Fail, &logEntry)
 	}
 
 	// Add to html entry.
 
-	absDestPath, _ := filepath.Abs(copyToPath)
-	logEntry.DestPath = absDestPath
-	logEntry.Outcome = outcome
+	if logEntry.DestPath != "" {
+		err = writeThumbnail(logEntry.DestPath, fileInfo.MediaKind, utils.GetThumbPath(subDirs.Thumbs, absSrcPath))
+		if err != nil {
+			logEntry.AddError(log.ErrCodeThumbnail, fmt.Sprintf("Error creating thumbnail: %s", err))
+		}
+	}
 
 	result = ConvertFileResult{
 		SrcPath:  srcPath,
@@ -264,3 +456,67 @@ func convertFile(job ConvertFileJob) (result ConvertFileResult) {
 	}
 	return result
 }
+
+// Copies the original file at srcPath into a subdirectory of failDir named for the
+// reason it failed, next to a text file explaining why.
+func saveFailedFile(srcPath string, failDir string, logEntry *log.LogEntry) {
+	logEntry.Outcome = types.OutcomeFail
+
+	reasonDir := filepath.Join(failDir, logEntry.FailReason)
+	err := os.MkdirAll(reasonDir, 0777)
+	if err != nil {
+		logEntry.AddError(log.ErrCodeCopy, fmt.Sprintf("Error creating fail directory: %s", err))
+		return
+	}
+
+	copyToPath := utils.GetAvailableDestPath(reasonDir, filepath.Base(srcPath))
+	out, err := exec.Command("cp", srcPath, copyToPath).CombinedOutput()
+	if err != nil {
+		logEntry.AddError(log.ErrCodeCopy, fmt.Sprintf("Error copying file to fail directory: %s, %s", err.Error(), string(out)))
+		return
+	}
+
+	absDestPath, _ := filepath.Abs(copyToPath)
+	logEntry.DestPath = absDestPath
+
+	lines := []string{
+		fmt.Sprintf("Source: %s", logEntry.SrcPath),
+		fmt.Sprintf("Reason: %s", logEntry.FailReason),
+		"Errors:",
+	}
+	for _, e := range logEntry.Errors {
+		lines = append(lines, fmt.Sprintf("- [%s] %s", e.Code, e.Message))
+	}
+	err = os.WriteFile(copyToPath+".txt", []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		logEntry.AddError(log.ErrCodeCopy, fmt.Sprintf("Error writing fail explanation: %s", err))
+	}
+}
+
+// Writes a thumbnail for the file at srcPath to destPath, falling back to the
+// thumbnail embedded in an image's exif data if the file can't be decoded.
+func writeThumbnail(srcPath string, mediaKind types.MediaKind, destPath string) error {
+	err := encode.CreateThumbnail(srcPath, destPath)
+	if err == nil || mediaKind != types.Image {
+		return err
+	}
+
+	bt, exifErr := exif.GetExifThumbnail(srcPath)
+	if exifErr != nil {
+		return err
+	}
+
+	err = os.WriteFile(destPath, bt, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Shrink the embedded thumbnail to the usual size, keeping it as is if it can't
+	// be decoded either.
+	shrunkPath := destPath + ".small.jpg"
+	if encode.CreateThumbnail(destPath, shrunkPath) == nil {
+		return os.Rename(shrunkPath, destPath)
+	}
+	os.Remove(shrunkPath)
+	return nil
+}
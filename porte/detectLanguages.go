@@ -0,0 +1,66 @@
+package porte
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Localized names of the Google Takeout folders that group photos by year, and
+// the languages they indicate.
+var takeoutFolderLanguages = []struct {
+	Re        *regexp.Regexp
+	Languages []string
+}{
+	{Re: regexp.MustCompile(`^Photos from \d{4}$`), Languages: []string{"en"}},
+	{Re: regexp.MustCompile(`^Fotos von \d{4}$`), Languages: []string{"de"}},
+	{Re: regexp.MustCompile(`^Photos de \d{4}$`), Languages: []string{"fr"}},
+	{Re: regexp.MustCompile(`^Fotos de \d{4}$`), Languages: []string{"es", "pt"}},
+	{Re: regexp.MustCompile(`^Foto's uit \d{4}$`), Languages: []string{"nl"}},
+	{Re: regexp.MustCompile(`^Foto dal \d{4}$`), Languages: []string{"it"}},
+}
+
+// Returns the languages indicated by any localized Takeout folder names among the
+// directories of relPaths, sorted.
+func detectLanguages(relPaths []string) []string {
+	seenDirs := map[string]bool{}
+	languages := []string{}
+
+	for _, p := range relPaths {
+		for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(p)), "/") {
+			if seenDirs[dir] {
+				continue
+			}
+			seenDirs[dir] = true
+
+			for _, f := range takeoutFolderLanguages {
+				if !f.Re.MatchString(dir) {
+					continue
+				}
+				for _, lang := range f.Languages {
+					if !slices.Contains(languages, lang) {
+						languages = append(languages, lang)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Strings(languages)
+	return languages
+}
+
+// Returns languages followed by any of detected not already included.
+func mergeLanguages(languages []string, detected []string) []string {
+	merged := append([]string{}, languages...)
+	for _, lang := range detected {
+		if !slices.Contains(merged, lang) {
+			merged = append(merged, lang)
+		}
+	}
+
+	return merged
+}
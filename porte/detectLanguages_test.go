@@ -0,0 +1,30 @@
+package porte
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestDetectLanguages(t *testing.T) {
+	type Iter struct {
+		relPaths          []string
+		expectedLanguages []string
+	}
+
+	var iters = []Iter{
+		{relPaths: []string{"Takeout/Google Fotos/Fotos von 2014/IMG_0001.jpg"}, expectedLanguages: []string{"de"}},
+		{relPaths: []string{"Photos de 2012/a.jpg", "Photos from 2013/b.jpg"}, expectedLanguages: []string{"en", "fr"}},
+		{relPaths: []string{"Trip/IMG_0001.jpg", "IMG_0002.jpg"}, expectedLanguages: []string{}},
+	}
+
+	for _, iter := range iters {
+		languages := detectLanguages(iter.relPaths)
+		if !slices.Equal(languages, iter.expectedLanguages) {
+			t.Fatalf("Expected languages %v for %v, but got %v", iter.expectedLanguages, iter.relPaths, languages)
+		}
+
+		fmt.Printf("Detected languages %v for %v\n", languages, iter.relPaths)
+	}
+}
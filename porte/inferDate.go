@@ -0,0 +1,134 @@
+package porte
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"porte/log"
+	"porte/types"
+)
+
+// Matches a file name ending in a sequence number, like IMG_0412, DSC01234, or
+// IMG_0412(1) for a duplicate.
+var sequenceNameRe = regexp.MustCompile(`^(.*?)(\d{3,})(\(\d+\))?$`)
+
+// Neighbors whose dates are within this span of each other are assumed to be from
+// the same session, so an estimate between them is given high confidence.
+const sameSessionSpan = 24 * time.Hour
+
+// Dated files, grouped into sequences, for estimating the dates of undated files
+// from their neighbors.
+type sequenceIndex struct {
+	sequences map[string][]sequenceEntry
+}
+
+type sequenceEntry struct {
+	Num  int
+	Path string
+	Date time.Time
+}
+
+func newSequenceIndex() *sequenceIndex {
+	return &sequenceIndex{sequences: map[string][]sequenceEntry{}}
+}
+
+// Records the date of the file at path. model is the file's Model tag, if any.
+func (idx *sequenceIndex) add(path string, model string, date time.Time) {
+	for _, k := range getSequenceKeys(path, model) {
+		idx.sequences[k.Key] = append(idx.sequences[k.Key], sequenceEntry{
+			Num:  k.Num,
+			Path: path,
+			Date: date,
+		})
+	}
+}
+
+// Returns a date for the file at path estimated from its nearest dated neighbors
+// no more than maxGap apart in its sequence, and the paths of those neighbors.
+// Sequences in the same folder are preferred over device sequences across folders.
+func (idx *sequenceIndex) estimate(path string, model string, maxGap int) (types.DateCandidate, []string, bool) {
+	for _, k := range getSequenceKeys(path, model) {
+		entries := idx.sequences[k.Key]
+
+		var before, after *sequenceEntry
+		for i, e := range entries {
+			if e.Num < k.Num && k.Num-e.Num <= maxGap && (before == nil || e.Num > before.Num) {
+				before = &entries[i]
+			}
+			if e.Num > k.Num && e.Num-k.Num <= maxGap && (after == nil || e.Num < after.Num) {
+				after = &entries[i]
+			}
+		}
+
+		if before == nil && after == nil {
+			continue
+		}
+
+		candidate := types.DateCandidate{
+			Src: log.DateSrcNeighbors,
+			Tag: types.ExifDateTag{Name: "CreateDate", HasZone: true},
+		}
+		paths := []string{}
+
+		if before != nil && after != nil && !after.Date.Before(before.Date) {
+			// Interpolate between the neighbors by sequence number.
+			span := after.Date.Sub(before.Date)
+			frac := float64(k.Num-before.Num) / float64(after.Num-before.Num)
+			candidate.Tag.Date = before.Date.Add(time.Duration(float64(span) * frac))
+			candidate.Confidence = types.DateConfidenceMedium
+			if span <= sameSessionSpan {
+				candidate.Confidence = types.DateConfidenceHigh
+			}
+			paths = append(paths, before.Path, after.Path)
+		} else {
+			// Only one neighbor is usable, so take its date as is.
+			nearest := before
+			if nearest == nil || (after != nil && after.Num-k.Num < k.Num-before.Num) {
+				nearest = after
+			}
+			candidate.Tag.Date = nearest.Date
+			candidate.Confidence = types.DateConfidenceLow
+			paths = append(paths, nearest.Path)
+		}
+
+		sort.Strings(paths)
+		return candidate, paths, true
+	}
+
+	return types.DateCandidate{}, nil, false
+}
+
+type sequenceKey struct {
+	Key string
+	Num int
+}
+
+// Returns the keys of the sequences the file at path belongs to, in order of
+// preference: its folder's sequence, then its device's sequence, if the device is
+// known.
+func getSequenceKeys(path string, model string) []sequenceKey {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	match := sequenceNameRe.FindStringSubmatch(name)
+	if match == nil {
+		return nil
+	}
+
+	num, err := strconv.Atoi(match[2])
+	if err != nil {
+		return nil
+	}
+	prefix := strings.ToLower(match[1])
+
+	keys := []sequenceKey{
+		{Key: "dir:" + filepath.Dir(path) + ":" + prefix, Num: num},
+	}
+	if model != "" {
+		keys = append(keys, sequenceKey{Key: "model:" + model + ":" + prefix, Num: num})
+	}
+
+	return keys
+}
@@ -0,0 +1,53 @@
+package porte
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"porte/types"
+)
+
+func TestEstimateNeighborDate(t *testing.T) {
+	type Iter struct {
+		path               string
+		model              string
+		expectedDate       time.Time
+		expectedConfidence types.DateConfidence
+		expectFound        bool
+	}
+
+	afternoon := time.Date(2019, 7, 12, 14, 0, 0, 0, time.UTC)
+
+	idx := newSequenceIndex()
+	idx.add("album/IMG_0411.jpg", "", afternoon)
+	idx.add("album/IMG_0413.jpg", "", afternoon.Add(2*time.Hour))
+	idx.add("album/IMG_0500.jpg", "", afternoon.AddDate(0, 1, 0))
+	idx.add("2019/DSC01000.jpg", "Canon EOS 5D", afternoon)
+
+	var iters = []Iter{
+		{path: "album/IMG_0412.jpg", expectedDate: afternoon.Add(time.Hour), expectedConfidence: types.DateConfidenceHigh, expectFound: true},
+		{path: "album/IMG_0412(1).jpg", expectedDate: afternoon.Add(time.Hour), expectedConfidence: types.DateConfidenceHigh, expectFound: true},
+		{path: "album/IMG_0420.jpg", expectedDate: afternoon.Add(2 * time.Hour), expectedConfidence: types.DateConfidenceLow, expectFound: true},
+		{path: "album/IMG_0450.jpg", expectFound: false},
+		{path: "other/IMG_0412.jpg", expectFound: false},
+		{path: "2020/DSC01001.jpg", model: "Canon EOS 5D", expectedDate: afternoon, expectedConfidence: types.DateConfidenceLow, expectFound: true},
+		{path: "album/photo.jpg", expectFound: false},
+	}
+
+	for _, iter := range iters {
+		candidate, paths, ok := idx.estimate(iter.path, iter.model, 10)
+		if ok != iter.expectFound {
+			t.Fatalf("Expected date found for '%s': %t, but got %t", iter.path, iter.expectFound, ok)
+		}
+		if !ok {
+			continue
+		}
+
+		if !candidate.Tag.Date.Equal(iter.expectedDate) || candidate.Confidence != iter.expectedConfidence {
+			t.Fatalf("Expected date '%s' with %s confidence for '%s', but got '%s' with %s confidence", iter.expectedDate, iter.expectedConfidence, iter.path, candidate.Tag.Date, candidate.Confidence)
+		}
+
+		fmt.Printf("Estimated date '%s' for '%s' from %v\n", candidate.Tag.Date, iter.path, paths)
+	}
+}
@@ -0,0 +1,113 @@
+package porte
+
+import (
+	"fmt"
+	"strings"
+
+	"porte/config"
+	"porte/types"
+)
+
+// Tags that may hold a description embedded in a file, in order of preference.
+var embeddedDescriptionTagNames = []string{
+	"Description",
+	"ImageDescription",
+	"Caption-Abstract",
+}
+
+// Descriptions that cameras write by default, which aren't worth keeping.
+var defaultDescriptions = []string{
+	"OLYMPUS DIGITAL CAMERA",
+	"SONY DSC",
+	"DIGITAL CAMERA",
+	"SAMSUNG",
+}
+
+// Returns the description to write to a file, combining the description embedded
+// in it with the one from its supplementary file according to policy.
+func getDescription(policy config.DescriptionPolicy, exifTags types.ExifTags, supplExifTags types.ExifTags) string {
+	embedded := ""
+	for _, n := range embeddedDescriptionTagNames {
+		v := strings.TrimSpace(exifTags.Misc[n].Value)
+		if v != "" && !isDefaultDescription(v) {
+			embedded = v
+			break
+		}
+	}
+	suppl := supplExifTags.Misc["Description"].Value
+
+	if embedded == "" {
+		return suppl
+	}
+	if suppl == "" {
+		return embedded
+	}
+
+	switch policy {
+	case config.DescriptionPolicyPreferJSON:
+		return suppl
+	case config.DescriptionPolicyPreferEmbedded:
+		return embedded
+	default:
+		if strings.Contains(embedded, suppl) {
+			return embedded
+		}
+		if strings.Contains(suppl, embedded) {
+			return suppl
+		}
+		return embedded + "\n\n" + suppl
+	}
+}
+
+func isDefaultDescription(v string) bool {
+	for _, d := range defaultDescriptions {
+		if strings.EqualFold(v, d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// How a file's Google Photos flags affect its export.
+type flagHandling struct {
+	// A description of the flag skip rule matched, if any.
+	SkipRule string
+	// Subdirectories of the success directory to export the file to, nested in
+	// order.
+	Subdirs  []string
+	Keywords []string
+	Rating   int
+	Label    string
+}
+
+// Returns how to export a file with flags, according to cfg.
+func getFlagHandling(cfg config.FlagsConfig, flags []types.Flag) flagHandling {
+	h := flagHandling{}
+
+	for _, f := range flags {
+		action := config.FlagActionKeep
+		switch f {
+		case types.FlagFavorited:
+			h.Rating = cfg.FavoriteRating
+			h.Label = cfg.FavoriteLabel
+		case types.FlagArchived:
+			action = cfg.Archived
+		case types.FlagTrashed:
+			action = cfg.Trashed
+		}
+
+		switch action {
+		case config.FlagActionTag:
+			h.Keywords = append(h.Keywords, f)
+		case config.FlagActionSubfolder:
+			h.Subdirs = append(h.Subdirs, f)
+		case config.FlagActionSkip:
+			if h.SkipRule == "" {
+				h.SkipRule = fmt.Sprintf("flags: '%s'", f)
+			}
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,77 @@
+package porte
+
+import (
+	"fmt"
+	"testing"
+
+	"porte/config"
+	"porte/types"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestGetDescription(t *testing.T) {
+	type Iter struct {
+		policy      config.DescriptionPolicy
+		embedded    string
+		suppl       string
+		expectedStr string
+	}
+
+	var iters = []Iter{
+		{policy: config.DescriptionPolicyAppend, embedded: "", suppl: "Grandma's 80th", expectedStr: "Grandma's 80th"},
+		{policy: config.DescriptionPolicyAppend, embedded: "OLYMPUS DIGITAL CAMERA", suppl: "Grandma's 80th", expectedStr: "Grandma's 80th"},
+		{policy: config.DescriptionPolicyAppend, embedded: "Lake house", suppl: "Grandma's 80th", expectedStr: "Lake house\n\nGrandma's 80th"},
+		{policy: config.DescriptionPolicyAppend, embedded: "Grandma's 80th", suppl: "Grandma's 80th", expectedStr: "Grandma's 80th"},
+		{policy: config.DescriptionPolicyPreferJSON, embedded: "Lake house", suppl: "Grandma's 80th", expectedStr: "Grandma's 80th"},
+		{policy: config.DescriptionPolicyPreferEmbedded, embedded: "Lake house", suppl: "Grandma's 80th", expectedStr: "Lake house"},
+		{policy: config.DescriptionPolicyPreferEmbedded, embedded: "Lake house", suppl: "", expectedStr: "Lake house"},
+	}
+
+	for _, iter := range iters {
+		exifTags := types.ExifTags{Misc: map[string]types.ExifStrTag{
+			"ImageDescription": {Name: "ImageDescription", Value: iter.embedded},
+		}}
+		supplExifTags := types.ExifTags{Misc: map[string]types.ExifStrTag{}}
+		if iter.suppl != "" {
+			supplExifTags.Misc["Description"] = types.ExifStrTag{Name: "Description", Value: iter.suppl}
+		}
+
+		actual := getDescription(iter.policy, exifTags, supplExifTags)
+		if actual != iter.expectedStr {
+			t.Fatalf("Expected description '%s' with policy '%s', but got '%s'", iter.expectedStr, iter.policy, actual)
+		}
+
+		fmt.Printf("Got description '%s' with policy '%s'\n", actual, iter.policy)
+	}
+}
+
+func TestGetFlagHandling(t *testing.T) {
+	type Iter struct {
+		flags            []types.Flag
+		expectedSkip     bool
+		expectedSubdirs  []string
+		expectedKeywords []string
+		expectedRating   int
+	}
+
+	cfg := config.Default().Flags
+	cfg.Archived = config.FlagActionSubfolder
+
+	var iters = []Iter{
+		{flags: nil},
+		{flags: []types.Flag{types.FlagFavorited}, expectedRating: 5},
+		{flags: []types.Flag{types.FlagArchived}, expectedSubdirs: []string{"archived"}},
+		{flags: []types.Flag{types.FlagFavorited, types.FlagTrashed}, expectedSkip: true, expectedRating: 5},
+	}
+
+	for _, iter := range iters {
+		h := getFlagHandling(cfg, iter.flags)
+		if (h.SkipRule != "") != iter.expectedSkip || !slices.Equal(h.Subdirs, iter.expectedSubdirs) ||
+			!slices.Equal(h.Keywords, iter.expectedKeywords) || h.Rating != iter.expectedRating {
+			t.Fatalf("Unexpected handling for flags %v: %+v", iter.flags, h)
+		}
+
+		fmt.Printf("Got handling %+v for flags %v\n", h, iter.flags)
+	}
+}
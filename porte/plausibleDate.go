@@ -0,0 +1,163 @@
+package porte
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"porte/config"
+	"porte/types"
+	"porte/utils"
+)
+
+// Release dates of common devices, by the value of their Model tag. A device can't
+// have captured a file before its release, so an earlier date is likely a default.
+var deviceReleaseDates = map[string]string{
+	"iPhone":            "2007-06-29",
+	"iPhone 3G":         "2008-07-11",
+	"iPhone 3GS":        "2009-06-19",
+	"iPhone 4":          "2010-06-24",
+	"iPhone 4S":         "2011-10-14",
+	"iPhone 5":          "2012-09-21",
+	"iPhone 5c":         "2013-09-20",
+	"iPhone 5s":         "2013-09-20",
+	"iPhone 6":          "2014-09-19",
+	"iPhone 6 Plus":     "2014-09-19",
+	"iPhone 6s":         "2015-09-25",
+	"iPhone 6s Plus":    "2015-09-25",
+	"iPhone SE":         "2016-03-31",
+	"iPhone 7":          "2016-09-16",
+	"iPhone 7 Plus":     "2016-09-16",
+	"iPhone 8":          "2017-09-22",
+	"iPhone 8 Plus":     "2017-09-22",
+	"iPhone X":          "2017-11-03",
+	"iPhone XS":         "2018-09-21",
+	"iPhone XS Max":     "2018-09-21",
+	"iPhone XR":         "2018-10-26",
+	"iPhone 11":         "2019-09-20",
+	"iPhone 11 Pro":     "2019-09-20",
+	"iPhone 11 Pro Max": "2019-09-20",
+	"iPhone 12":         "2020-10-23",
+	"iPhone 12 Pro":     "2020-10-23",
+	"iPhone 12 mini":    "2020-11-13",
+	"iPhone 12 Pro Max": "2020-11-13",
+	"iPhone 13":         "2021-09-24",
+	"iPhone 13 mini":    "2021-09-24",
+	"iPhone 13 Pro":     "2021-09-24",
+	"iPhone 13 Pro Max": "2021-09-24",
+	"iPhone 14":         "2022-09-16",
+	"iPhone 14 Plus":    "2022-10-07",
+	"iPhone 14 Pro":     "2022-09-16",
+	"iPhone 14 Pro Max": "2022-09-16",
+	"iPhone 15":         "2023-09-22",
+	"iPhone 15 Plus":    "2023-09-22",
+	"iPhone 15 Pro":     "2023-09-22",
+	"iPhone 15 Pro Max": "2023-09-22",
+	"Pixel":             "2016-10-20",
+	"Pixel XL":          "2016-10-20",
+	"Pixel 2":           "2017-10-19",
+	"Pixel 2 XL":        "2017-10-19",
+	"Pixel 3":           "2018-10-18",
+	"Pixel 3 XL":        "2018-10-18",
+	"Pixel 4":           "2019-10-24",
+	"Pixel 4 XL":        "2019-10-24",
+	"Pixel 5":           "2020-10-29",
+	"Pixel 6":           "2021-10-28",
+	"Pixel 6 Pro":       "2021-10-28",
+	"Pixel 7":           "2022-10-13",
+	"Pixel 7 Pro":       "2022-10-13",
+	"Pixel 8":           "2023-10-12",
+	"Pixel 8 Pro":       "2023-10-12",
+}
+
+// Marks each candidate whose date fails a plausibility rule in cfg as lost, with
+// the rule as the reason. model is the file's Model tag, if any, and now is the
+// time of the run.
+func rejectImplausibleDates(candidates []types.DateCandidate, cfg config.PlausibilityConfig, model string, now time.Time) {
+	for i, c := range candidates {
+		if cfg.RejectGPSDates && isGPSDateSrc(c.Src) {
+			candidates[i].LostReason = "implausible: GPS fix time, not capture time"
+			continue
+		}
+
+		reason := getImplausibleDateReason(c.Tag.Date, c.Precision, cfg, model, now)
+		if reason != "" {
+			candidates[i].LostReason = "implausible: " + reason
+		}
+	}
+}
+
+// Returns whether src is an exif GPS date tag, like "exif:GPSDateStamp".
+func isGPSDateSrc(src string) bool {
+	return strings.HasPrefix(src, config.DateSrcExifPrefix+"GPS")
+}
+
+// Returns a description of the first plausibility rule in cfg that date fails, or
+// an empty string if it passes all of them. A date known only to the day, month,
+// or year, like the start of the year for a folder named "Photos from 2000", isn't
+// compared to sentinels, and is compared to device releases by its period's end.
+func getImplausibleDateReason(date time.Time, precision string, cfg config.PlausibilityConfig, model string, now time.Time) string {
+	if cfg.MinYear > 0 && date.Year() < cfg.MinYear {
+		return fmt.Sprintf("before minYear %d", cfg.MinYear)
+	}
+
+	if cfg.RejectFuture && date.After(now) {
+		return "after the time of the run"
+	}
+
+	periodEnd := getDatePeriodEnd(date, precision)
+	if periodEnd.Equal(date) {
+		local := date.Format(config.SentinelDateFmt)
+		utc := date.UTC().Format(config.SentinelDateFmt)
+		for _, s := range cfg.Sentinels {
+			if s == local || s == utc {
+				return fmt.Sprintf("sentinel '%s'", s)
+			}
+		}
+	}
+
+	if cfg.RejectBeforeDeviceRelease && model != "" {
+		release, exists := getDeviceReleaseDate(cfg, model)
+		if exists && periodEnd.Before(release) {
+			return fmt.Sprintf("before the release of '%s' on %s", model, release.Format("2006-01-02"))
+		}
+	}
+
+	return ""
+}
+
+// Returns the end of the day, month, or year starting at date, according to
+// precision, or date itself if it's more precise than a day.
+func getDatePeriodEnd(date time.Time, precision string) time.Time {
+	switch precision {
+	case utils.DatePrecisionDay:
+		return date.AddDate(0, 0, 1)
+	case utils.DatePrecisionMonth:
+		return date.AddDate(0, 1, 0)
+	case utils.DatePrecisionYear:
+		return date.AddDate(1, 0, 0)
+	}
+
+	return date
+}
+
+// Returns the release date of the device with the given Model tag, preferring
+// dates from cfg over the built-in list.
+func getDeviceReleaseDate(cfg config.PlausibilityConfig, model string) (time.Time, bool) {
+	model = strings.TrimSpace(model)
+
+	for m, d := range cfg.DeviceReleaseDates {
+		if strings.EqualFold(m, model) {
+			return d, true
+		}
+	}
+
+	for m, d := range deviceReleaseDates {
+		if strings.EqualFold(m, model) {
+			release, err := time.Parse("2006-01-02", d)
+			return release, err == nil
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,122 @@
+package porte
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"porte/config"
+	"porte/types"
+	"porte/utils"
+)
+
+func TestGetImplausibleDateReason(t *testing.T) {
+	type Iter struct {
+		date           time.Time
+		precision      string
+		model          string
+		expectRejected bool
+	}
+
+	cfg := config.Default().Dates.Plausibility
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var iters = []Iter{
+		{date: time.Date(2015, 11, 7, 18, 41, 26, 0, time.UTC), expectRejected: false},
+		{date: time.Date(1850, 1, 1, 0, 0, 0, 0, time.UTC), expectRejected: true},
+		{date: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), expectRejected: true},
+		{date: time.Date(2000, 1, 1, 0, 0, 0, 0, newYork), expectRejected: true},
+		{date: time.Date(1969, 12, 31, 19, 0, 0, 0, newYork), expectRejected: true},
+		{date: time.Date(2015, 11, 7, 18, 41, 26, 0, time.UTC), model: "iPhone 6", expectRejected: false},
+		{date: time.Date(2012, 11, 7, 18, 41, 26, 0, time.UTC), model: "iPhone 6", expectRejected: true},
+		{date: time.Date(2012, 11, 7, 18, 41, 26, 0, time.UTC), model: "Unknown Camera", expectRejected: false},
+		{date: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), precision: utils.DatePrecisionYear, expectRejected: false},
+		{date: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC), precision: utils.DatePrecisionMonth, expectRejected: false},
+		{date: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), precision: utils.DatePrecisionDay, expectRejected: false},
+		{date: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC), precision: utils.DatePrecisionYear, model: "iPhone 6", expectRejected: false},
+		{date: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC), precision: utils.DatePrecisionMonth, model: "iPhone 6", expectRejected: true},
+		{date: time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC), precision: utils.DatePrecisionYear, model: "iPhone 6", expectRejected: true},
+	}
+
+	for _, iter := range iters {
+		reason := getImplausibleDateReason(iter.date, iter.precision, cfg, iter.model, now)
+		if (reason != "") != iter.expectRejected {
+			t.Fatalf("Expected date '%s' from model '%s' to be rejected: %t, but got reason '%s'", iter.date, iter.model, iter.expectRejected, reason)
+		}
+
+		fmt.Printf("Checked date '%s' from model '%s': '%s'\n", iter.date, iter.model, reason)
+	}
+}
+
+func TestRejectImplausibleFolderDates(t *testing.T) {
+	type Iter struct {
+		relPath        string
+		expectRejected bool
+	}
+
+	cfg := config.Default().Dates.Plausibility
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var iters = []Iter{
+		{relPath: "Photos from 2000/IMG_0001.jpg", expectRejected: false},
+		{relPath: "2000-01 Trip/IMG_0001.jpg", expectRejected: false},
+		{relPath: "Scans/1970/IMG_0001.jpg", expectRejected: false},
+	}
+
+	for _, iter := range iters {
+		candidates, _, _ := getDateCandidates(types.FileInfo{Name: "IMG_0001.jpg", RelPath: iter.relPath}, types.ExifTags{}, types.ExifTags{}, nil, nil)
+		if len(candidates) != 1 || candidates[0].Src != config.DateSrcFolder {
+			t.Fatalf("Expected a single folder date for '%s', but got %+v", iter.relPath, candidates)
+		}
+
+		rejectImplausibleDates(candidates, cfg, "", now)
+		if (candidates[0].LostReason != "") != iter.expectRejected {
+			t.Fatalf("Expected folder date for '%s' to be rejected: %t, but got reason '%s'", iter.relPath, iter.expectRejected, candidates[0].LostReason)
+		}
+
+		fmt.Printf("Checked folder date %s for '%s': '%s'\n", candidates[0].Tag.Date, iter.relPath, candidates[0].LostReason)
+	}
+}
+
+func TestRejectGPSDates(t *testing.T) {
+	type Iter struct {
+		src            string
+		rejectGPSDates bool
+		expectRejected bool
+	}
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	date := time.Date(2019, 7, 12, 0, 0, 0, 0, time.UTC)
+
+	var iters = []Iter{
+		{src: "exif:GPSDateStamp", rejectGPSDates: true, expectRejected: true},
+		{src: "exif:GPSDateTime", rejectGPSDates: true, expectRejected: true},
+		{src: "exif:DateTimeOriginal", rejectGPSDates: true, expectRejected: false},
+		{src: "exif:GPSDateTime", rejectGPSDates: false, expectRejected: false},
+	}
+
+	for _, iter := range iters {
+		cfg := config.Default().Dates.Plausibility
+		cfg.RejectGPSDates = iter.rejectGPSDates
+		candidates := []types.DateCandidate{{Src: iter.src, Tag: types.ExifDateTag{Name: iter.src, Date: date, HasZone: true}}}
+
+		rejectImplausibleDates(candidates, cfg, "", now)
+		if (candidates[0].LostReason != "") != iter.expectRejected {
+			t.Fatalf("Expected '%s' to be rejected: %t, but got reason '%s'", iter.src, iter.expectRejected, candidates[0].LostReason)
+		}
+
+		fmt.Printf("Checked '%s': '%s'\n", iter.src, candidates[0].LostReason)
+	}
+
+	// A GPS date isn't used even when it's the only date.
+	candidates := []types.DateCandidate{{Src: "exif:GPSDateStamp", Tag: types.ExifDateTag{Name: "GPSDateStamp", Date: date}}}
+	rejectImplausibleDates(candidates, config.Default().Dates.Plausibility, "", now)
+	_, _, ok := selectDate(candidates, config.Default().Dates.Priority)
+	if ok {
+		t.Fatalf("Expected no date to be selected from only a GPS date")
+	}
+}
@@ -1,23 +1,34 @@
 package porte
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
+	"porte/config"
 	"porte/console"
 	"porte/lib"
 	"porte/log"
+	"porte/report"
 )
 
-func Run(srcDir string, destDir string) error {
+func Run(srcDir string, destDir string, cfg config.Config) error {
 	// Set up environment.
 
-	logFilePath := log.Start(destDir)
+	logFilePath, err := log.Start(destDir)
+	if err != nil {
+		return err
+	}
+	// Finish the log even if the run is aborted, so it ends with a summary. Once
+	// it's finished below, this does nothing.
+	defer log.Finish()
 	console.Start()
 	totalStart := time.Now()
 
 	// Validate and install dependencies.
 
-	_, err := lib.GetLibs()
+	_, err = lib.GetLibs()
 	if err != nil {
 		return err
 	}
@@ -29,12 +40,51 @@ func Run(srcDir string, destDir string) error {
 		return err
 	}
 
+	// Search for dates in the languages of the source's folder names, if enabled.
+
+	if cfg.Dates.DetectLanguages {
+		cfg.Dates.Languages = mergeLanguages(cfg.Dates.Languages, srcInfo.DetectedLanguages)
+	}
+
 	// Convert all files.
 
-	err = convertDir(srcInfo, destDir, logFilePath, totalStart)
+	err = convertDir(srcInfo, destDir, cfg)
 	if err != nil {
 		return err
 	}
 
+	// Finalize the log, and convert it for anyone who prefers a single document.
+
+	_, err = log.Finish()
+	if err != nil {
+		return err
+	}
+
+	prettyLogFilePath := filepath.Join(destDir, "log.json")
+	err = log.WritePretty(logFilePath, prettyLogFilePath)
+	if err != nil {
+		return err
+	}
+
+	// Render a report for reviewing the run in a browser.
+
+	thumbDir := filepath.Join(destDir, ".thumbs")
+	defer os.RemoveAll(thumbDir)
+
+	reportFilePath := filepath.Join(destDir, "report.html")
+	err = report.Write(logFilePath, thumbDir, reportFilePath)
+	if err != nil {
+		return err
+	}
+
+	// Tell us about it.
+
+	console.Update(console.PhaseComplete, [][]string{
+		{"", fmt.Sprintf("- Files exported to '%s'", destDir)},
+		{"", fmt.Sprintf("- Log saved to '%s'", logFilePath)},
+		{"", fmt.Sprintf("- Report saved to '%s'", reportFilePath)},
+		{"", "- " + console.GetElapsedStr(totalStart) + " total elapsed"},
+	})
+
 	return nil
 }
@@ -9,7 +9,10 @@ import (
 	"testing"
 	"time"
 
+	"porte/config"
 	"porte/exif"
+	"porte/log"
+	"porte/types"
 	"porte/utils"
 
 	"gopkg.in/yaml.v3"
@@ -83,10 +86,21 @@ func TestRun(t *testing.T) {
 			t.Fatalf("Error parsing yaml: %s", err)
 		}
 
+		// Parse the fixture's config, if one exists.
+
+		cfg := config.Default()
+		cfgPath := filepath.Join(inDir, "config.yaml")
+		if _, err := os.Stat(cfgPath); err == nil {
+			cfg, err = config.Load(cfgPath)
+			if err != nil {
+				t.Fatalf("Error loading config: %s", err)
+			}
+		}
+
 		// Parse and convert all files in the directory.
 
 		fmt.Printf("Processing directory '%s'\n", inDir)
-		err = Run(inDir, outDirRoot)
+		err = Run(inDir, outDirRoot, cfg)
 		if err != nil {
 			t.Fatalf("Error handling directory '%s': %s", inDir, err)
 		}
@@ -157,7 +171,9 @@ func TestRun(t *testing.T) {
 				if err != nil {
 					t.Fatalf("- Invalid date for expected tag %s: %s\n", expected.Name, expected.Value)
 				}
-				if !actual.Date.Equal(expectedDate) {
+				// Compare wall-clock times, since a date may be stored with its offset.
+				actualDate := utils.WallClockIn(actual.Date, time.UTC)
+				if !actualDate.Equal(expectedDate) {
 					t.Fatalf("- For tag %s, expected %s but got %s\n", expected.Name, expectedDate, actual.Date)
 				}
 				fmt.Printf("- For tag %s, found expected date %s\n", expected.Name, actual.Date)
@@ -174,5 +190,26 @@ func TestRun(t *testing.T) {
 				fmt.Printf("- For tag %s, found expected value %s\n", expected.Name, actual.Value)
 			}
 		}
+
+		// Verify skipped files were logged as skipped.
+
+		outcomes := map[string]types.Outcome{}
+		err = log.ReadRecords(filepath.Join(outDirRoot, "log.jsonl"), func(record log.Record) error {
+			if record.Kind == log.RecordKindEntry {
+				outcomes[filepath.Base(record.Entry.SrcPath)] = record.Entry.Outcome
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error reading log: %s\n", err)
+		}
+
+		for _, expecteds := range expected.Skip {
+			outcome := outcomes[expecteds.FileName]
+			if outcome != types.OutcomeSkip {
+				t.Fatalf("Expected '%s' to be skipped but got outcome '%s'\n", expecteds.FileName, outcome)
+			}
+			fmt.Printf("Found skipped file: '%s'\n", expecteds.FileName)
+		}
 	}
 }
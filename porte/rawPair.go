@@ -0,0 +1,54 @@
+package porte
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"porte/config"
+	"porte/exif"
+)
+
+// The destinations of converted images, by directory and base name, for finding
+// the image a RAW file was shot with, like IMG_0001.JPG for IMG_0001.CR2.
+type rawPairIndex struct {
+	destPaths map[string]string
+}
+
+func newRawPairIndex() *rawPairIndex {
+	return &rawPairIndex{destPaths: map[string]string{}}
+}
+
+// Records that the image at srcPath was saved to destPath.
+func (idx *rawPairIndex) add(srcPath string, destPath string) {
+	idx.destPaths[getRawPairKey(srcPath)] = destPath
+}
+
+// Returns the destination of the image in the same directory as the RAW file at
+// srcPath, with the same base name, or an empty string if there is none.
+func (idx *rawPairIndex) getDestPath(srcPath string) string {
+	return idx.destPaths[getRawPairKey(srcPath)]
+}
+
+// Pairs are matched regardless of case, since cameras often name the RAW file
+// IMG_0001.CR2 and the JPEG IMG_0001.jpg.
+func getRawPairKey(path string) string {
+	return strings.ToLower(strings.TrimSuffix(path, filepath.Ext(path)))
+}
+
+// Returns the sidecar naming for a RAW file saved next to the image at
+// pairDestPath. With Lightroom naming, both files' sidecars would be named after
+// their shared base name, so if the image already has one, the RAW file falls back
+// to darktable naming, and fellBack is true.
+func getPairSidecarNaming(naming config.SidecarNaming, pairDestPath string) (pairNaming config.SidecarNaming, fellBack bool) {
+	if naming != config.SidecarNamingLightroom {
+		return naming, false
+	}
+
+	_, err := os.Stat(exif.GetSidecarPath(pairDestPath, naming))
+	if err != nil {
+		return naming, false
+	}
+
+	return config.SidecarNamingDarktable, true
+}
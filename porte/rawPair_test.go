@@ -0,0 +1,78 @@
+package porte
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"porte/config"
+	"porte/exif"
+)
+
+func TestRawPairIndex(t *testing.T) {
+	type Iter struct {
+		rawPath          string
+		expectedDestPath string
+	}
+
+	pairs := newRawPairIndex()
+	pairs.add("takeout/Photos from 2019/IMG_0001.jpg", "out/success/2019-07-12_18-34-55_IMG_0001.jpg")
+	pairs.add("takeout/Photos from 2019/DSC_0420.JPG", "out/success/2019-07-13_09-00-00_DSC_0420.jpg")
+
+	var iters = []Iter{
+		{rawPath: "takeout/Photos from 2019/IMG_0001.CR2", expectedDestPath: "out/success/2019-07-12_18-34-55_IMG_0001.jpg"},
+		{rawPath: "takeout/Photos from 2019/DSC_0420.nef", expectedDestPath: "out/success/2019-07-13_09-00-00_DSC_0420.jpg"},
+		{rawPath: "takeout/Photos from 2020/IMG_0001.CR2", expectedDestPath: ""},
+		{rawPath: "takeout/Photos from 2019/IMG_0002.CR2", expectedDestPath: ""},
+	}
+
+	for _, iter := range iters {
+		destPath := pairs.getDestPath(iter.rawPath)
+		if destPath != iter.expectedDestPath {
+			t.Fatalf("Expected pair '%s' for '%s', but got '%s'", iter.expectedDestPath, iter.rawPath, destPath)
+		}
+
+		fmt.Printf("Got pair '%s' for '%s'\n", destPath, iter.rawPath)
+	}
+}
+
+func TestGetPairSidecarNaming(t *testing.T) {
+	type Iter struct {
+		naming           config.SidecarNaming
+		pairHasSidecar   bool
+		expectedFellBack bool
+	}
+
+	var iters = []Iter{
+		{naming: config.SidecarNamingLightroom, pairHasSidecar: true, expectedFellBack: true},
+		{naming: config.SidecarNamingLightroom, pairHasSidecar: false, expectedFellBack: false},
+		{naming: config.SidecarNamingDarktable, pairHasSidecar: true, expectedFellBack: false},
+	}
+
+	for _, iter := range iters {
+		dir := t.TempDir()
+		pairDestPath := filepath.Join(dir, "2019-07-12_18-34-55_IMG_0001.jpg")
+		rawDestPath := filepath.Join(dir, "2019-07-12_18-34-55_IMG_0001.cr2")
+		_ = os.WriteFile(pairDestPath, []byte("jpeg"), 0644)
+		pairSidecarPath := ""
+		if iter.pairHasSidecar {
+			pairSidecarPath = exif.GetSidecarPath(pairDestPath, iter.naming)
+			_ = os.WriteFile(pairSidecarPath, []byte("xmp"), 0644)
+		}
+
+		naming, fellBack := getPairSidecarNaming(iter.naming, pairDestPath)
+		if fellBack != iter.expectedFellBack {
+			t.Fatalf("Expected fallback %t for %s naming, but got %t", iter.expectedFellBack, iter.naming, fellBack)
+		}
+
+		// The pair's sidecars must be distinct, so that the RAW file keeps the image's
+		// name.
+		rawSidecarPath := exif.GetSidecarPath(rawDestPath, naming)
+		if rawSidecarPath == pairSidecarPath {
+			t.Fatalf("Expected distinct sidecars for %s naming, but both are '%s'", iter.naming, rawSidecarPath)
+		}
+
+		fmt.Printf("Got sidecar '%s' next to '%s' for %s naming\n", filepath.Base(rawSidecarPath), filepath.Base(pairSidecarPath), iter.naming)
+	}
+}
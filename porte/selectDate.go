@@ -0,0 +1,150 @@
+package porte
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"porte/config"
+	"porte/types"
+	"porte/utils"
+)
+
+// Returns every date that could be used as the capture date of a file, from its
+// exif tags, its supplementary file, its name, and its folders. Wall-clock dates
+// without a zone are placed in loc, if it is known. Also returns the string
+// searched for a date in the name, and the dates parsed from strings by source.
+func getDateCandidates(fileInfo types.FileInfo, exifTags types.ExifTags, supplExifTags types.ExifTags, loc *time.Location, languages []string) (candidates []types.DateCandidate, fileNameSearchStr string, strDates map[string]utils.StrDate) {
+	strDates = map[string]utils.StrDate{}
+
+	for _, t := range exifTags.Dates {
+		candidates = append(candidates, types.DateCandidate{
+			Src: config.DateSrcExifPrefix + t.Name,
+			Tag: inLocalZone(t, loc),
+		})
+	}
+	for _, t := range supplExifTags.Dates {
+		candidates = append(candidates, types.DateCandidate{
+			Src: config.DateSrcJSONPrefix + t.Name,
+			Tag: inLocalZone(t, loc),
+		})
+	}
+
+	// The filename or image title may indicate a date, for example when an older
+	// photo was digitized later, causing the exif data to be incorrect.
+	fileNameSearchStr = fileInfo.Name + " " + supplExifTags.Misc["ImageTitle"].Value
+	fileNameDate, err := utils.GetDateFromStr(fileNameSearchStr, languages)
+	if err == nil {
+		strDates[config.DateSrcFileName] = fileNameDate
+		candidates = append(candidates, types.DateCandidate{
+			Src: config.DateSrcFileName,
+			Tag: inLocalZone(types.ExifDateTag{
+				Name: "CreateDate",
+				Date: fileNameDate.Date,
+			}, loc),
+			Precision: fileNameDate.Precision,
+		})
+	}
+
+	// A containing folder may name the month or year, like "Photos from 2014".
+	folderDate, err := utils.GetDateFromFolders(filepath.Dir(fileInfo.RelPath))
+	if err == nil {
+		strDates[config.DateSrcFolder] = folderDate
+		candidates = append(candidates, types.DateCandidate{
+			Src: config.DateSrcFolder,
+			Tag: inLocalZone(types.ExifDateTag{
+				Name: "CreateDate",
+				Date: folderDate.Date,
+			}, loc),
+			Precision: folderDate.Precision,
+		})
+	}
+
+	// Sort for a stable log, since tags are read from maps.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Src < candidates[j].Src
+	})
+
+	return candidates, fileNameSearchStr, strDates
+}
+
+// Chooses the date from candidates whose source comes first in priority, breaking
+// ties with the earliest date. Candidates already marked as lost are never chosen.
+// Returns the winner, and all candidates annotated with their rank and the reason
+// each one lost.
+func selectDate(candidates []types.DateCandidate, priority []string) (winner types.DateCandidate, ranked []types.DateCandidate, ok bool) {
+	ranked = make([]types.DateCandidate, len(candidates))
+	winnerIdx := -1
+
+	for i, c := range candidates {
+		c.Rank = getDateSrcRank(c.Src, priority)
+		ranked[i] = c
+		if c.Rank < 0 || c.LostReason != "" {
+			continue
+		}
+
+		if winnerIdx < 0 {
+			winnerIdx = i
+			continue
+		}
+		w := ranked[winnerIdx]
+		if c.Rank < w.Rank || (c.Rank == w.Rank && c.Tag.Date.Before(w.Tag.Date)) {
+			winnerIdx = i
+		}
+	}
+
+	if winnerIdx < 0 {
+		for i, c := range ranked {
+			if c.LostReason == "" {
+				ranked[i].LostReason = "not in priority list"
+			}
+		}
+		return types.DateCandidate{}, ranked, false
+	}
+
+	winner = ranked[winnerIdx]
+	for i, c := range ranked {
+		if i == winnerIdx || c.LostReason != "" {
+			continue
+		}
+
+		if c.Rank < 0 {
+			ranked[i].LostReason = "not in priority list"
+		} else if c.Rank > winner.Rank {
+			ranked[i].LostReason = fmt.Sprintf("lower priority than %s", winner.Src)
+		} else {
+			ranked[i].LostReason = fmt.Sprintf("later than %s at the same priority", winner.Src)
+		}
+	}
+
+	return winner, ranked, true
+}
+
+// Returns the position of src in priority, or -1 if it isn't listed. An exif
+// source matches the exif wildcard if it isn't listed explicitly.
+func getDateSrcRank(src string, priority []string) int {
+	wildcardRank := -1
+	for i, p := range priority {
+		if p == src {
+			return i
+		}
+		if p == config.DateSrcExifAny && wildcardRank < 0 && strings.HasPrefix(src, config.DateSrcExifPrefix) {
+			wildcardRank = i
+		}
+	}
+
+	return wildcardRank
+}
+
+// Returns t with a wall-clock date placed in loc, if loc is known.
+func inLocalZone(t types.ExifDateTag, loc *time.Location) types.ExifDateTag {
+	if t.HasZone || loc == nil {
+		return t
+	}
+
+	t.Date = utils.WallClockIn(t.Date, loc)
+	t.HasZone = true
+	return t
+}
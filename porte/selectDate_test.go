@@ -0,0 +1,61 @@
+package porte
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"porte/types"
+)
+
+func TestSelectDate(t *testing.T) {
+	type Iter struct {
+		candidates  []types.DateCandidate
+		priority    []string
+		expectedSrc string
+	}
+
+	early := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	candidate := func(src string, date time.Time) types.DateCandidate {
+		return types.DateCandidate{Src: src, Tag: types.ExifDateTag{Date: date, HasZone: true}}
+	}
+
+	var iters = []Iter{
+		{
+			candidates:  []types.DateCandidate{candidate("exif:ModifyDate", early), candidate("json:photoTakenTime", late)},
+			priority:    []string{"json:photoTakenTime", "exif:*"},
+			expectedSrc: "json:photoTakenTime",
+		},
+		{
+			candidates:  []types.DateCandidate{candidate("exif:ModifyDate", late), candidate("exif:DateTimeOriginal", early)},
+			priority:    []string{"exif:*"},
+			expectedSrc: "exif:DateTimeOriginal",
+		},
+		{
+			candidates:  []types.DateCandidate{candidate("exif:DateTimeOriginal", late), candidate("exif:ModifyDate", early)},
+			priority:    []string{"exif:DateTimeOriginal", "exif:*"},
+			expectedSrc: "exif:DateTimeOriginal",
+		},
+		{
+			candidates:  []types.DateCandidate{candidate("filename", early)},
+			priority:    []string{"exif:*"},
+			expectedSrc: "",
+		},
+	}
+
+	for _, iter := range iters {
+		winner, ranked, _ := selectDate(iter.candidates, iter.priority)
+		if winner.Src != iter.expectedSrc {
+			t.Fatalf("Expected date from '%s' but got '%s'", iter.expectedSrc, winner.Src)
+		}
+
+		for _, c := range ranked {
+			if c.Src != winner.Src && c.LostReason == "" {
+				t.Fatalf("Expected a reason for candidate '%s' losing", c.Src)
+			}
+		}
+
+		fmt.Printf("Selected date from '%s' among %v\n", winner.Src, ranked)
+	}
+}
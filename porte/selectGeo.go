@@ -0,0 +1,81 @@
+package porte
+
+import (
+	"fmt"
+
+	"porte/config"
+	"porte/exif"
+	"porte/types"
+	"porte/tz"
+
+	"golang.org/x/exp/slices"
+)
+
+// Returns every location that could be used for a file, from its GPS tags and from
+// both locations in its supplementary file, in a fixed order.
+func getGeoCandidates(exifTags types.ExifTags, supplExifTags types.ExifTags) []types.GeoCandidate {
+	candidates := []types.GeoCandidate{}
+
+	srcTags := []struct {
+		Src  string
+		Tags map[string]types.ExifStrTag
+	}{
+		{config.GeoSrcExif, exifTags.Geo},
+		{config.GeoSrcJSONGeoData, supplExifTags.Geo},
+		{config.GeoSrcJSONGeoDataExif, supplExifTags.GeoExif},
+	}
+	for _, st := range srcTags {
+		loc, ok := exif.GetGeoLocation(st.Tags, st.Src)
+		if ok {
+			candidates = append(candidates, types.GeoCandidate{Loc: loc})
+		}
+	}
+
+	return candidates
+}
+
+// Returns the location from the highest priority source in candidates, if any
+// source is listed in cfg's priority, along with every candidate ranked against
+// it. A candidate further from the winner than the conflict threshold is marked
+// as a conflict.
+func selectGeo(candidates []types.GeoCandidate, cfg config.GeoConfig) (winner types.GeoLocation, ranked []types.GeoCandidate, ok bool) {
+	ranked = make([]types.GeoCandidate, len(candidates))
+	winnerIdx := -1
+
+	for i, c := range candidates {
+		c.Rank = slices.Index(cfg.Priority, c.Loc.Src)
+		ranked[i] = c
+		if c.Rank < 0 {
+			continue
+		}
+
+		if winnerIdx < 0 || c.Rank < ranked[winnerIdx].Rank {
+			winnerIdx = i
+		}
+	}
+
+	if winnerIdx < 0 {
+		for i := range ranked {
+			ranked[i].LostReason = "not in priority list"
+		}
+		return types.GeoLocation{}, ranked, false
+	}
+
+	winner = ranked[winnerIdx].Loc
+	for i, c := range ranked {
+		if i == winnerIdx {
+			continue
+		}
+
+		if c.Rank < 0 {
+			ranked[i].LostReason = "not in priority list"
+		} else {
+			ranked[i].LostReason = fmt.Sprintf("lower priority than %s", winner.Src)
+		}
+
+		ranked[i].DistanceKm = tz.DistanceKm(winner.Lat, winner.Lon, c.Loc.Lat, c.Loc.Lon)
+		ranked[i].Conflict = ranked[i].DistanceKm > cfg.ConflictThresholdKm
+	}
+
+	return winner, ranked, true
+}
@@ -0,0 +1,74 @@
+package porte
+
+import (
+	"fmt"
+	"testing"
+
+	"porte/config"
+	"porte/types"
+)
+
+func TestSelectGeo(t *testing.T) {
+	type Iter struct {
+		candidates        []types.GeoCandidate
+		priority          []string
+		expectedSrc       string
+		expectedConflicts []string
+	}
+
+	candidate := func(src string, lat float64, lon float64) types.GeoCandidate {
+		return types.GeoCandidate{Loc: types.GeoLocation{Lat: lat, Lon: lon, Src: src}}
+	}
+	defaultPriority := config.Default().Geo.Priority
+
+	var iters = []Iter{
+		{
+			// Nearby locations don't conflict.
+			candidates:        []types.GeoCandidate{candidate("exif", 40.6892, -74.0445), candidate("json:geoData", 40.6893, -74.0446)},
+			priority:          defaultPriority,
+			expectedSrc:       "json:geoData",
+			expectedConflicts: []string{},
+		},
+		{
+			// A location edited in Google Photos conflicts with the file's.
+			candidates:        []types.GeoCandidate{candidate("exif", 40.6892, -74.0445), candidate("json:geoData", 48.8584, 2.2945), candidate("json:geoDataExif", 40.6892, -74.0445)},
+			priority:          defaultPriority,
+			expectedSrc:       "json:geoData",
+			expectedConflicts: []string{"exif", "json:geoDataExif"},
+		},
+		{
+			candidates:        []types.GeoCandidate{candidate("json:geoData", 48.8584, 2.2945), candidate("exif", 40.6892, -74.0445)},
+			priority:          []string{"exif", "json:geoData"},
+			expectedSrc:       "exif",
+			expectedConflicts: []string{"json:geoData"},
+		},
+		{
+			candidates:        []types.GeoCandidate{candidate("json:geoDataExif", 40.6892, -74.0445)},
+			priority:          []string{"exif"},
+			expectedSrc:       "",
+			expectedConflicts: []string{},
+		},
+	}
+
+	for _, iter := range iters {
+		winner, ranked, _ := selectGeo(iter.candidates, config.GeoConfig{Priority: iter.priority, ConflictThresholdKm: 1})
+		if winner.Src != iter.expectedSrc {
+			t.Fatalf("Expected location from '%s' but got '%s'", iter.expectedSrc, winner.Src)
+		}
+
+		conflicts := []string{}
+		for _, c := range ranked {
+			if c.Loc.Src != winner.Src && c.LostReason == "" {
+				t.Fatalf("Expected a reason for candidate '%s' losing", c.Loc.Src)
+			}
+			if c.Conflict {
+				conflicts = append(conflicts, c.Loc.Src)
+			}
+		}
+		if fmt.Sprint(conflicts) != fmt.Sprint(iter.expectedConflicts) {
+			t.Fatalf("Expected conflicts %v but got %v", iter.expectedConflicts, conflicts)
+		}
+
+		fmt.Printf("Selected location from '%s' among %v\n", winner.Src, ranked)
+	}
+}
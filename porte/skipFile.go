@@ -0,0 +1,103 @@
+package porte
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"porte/config"
+	"porte/types"
+
+	"golang.org/x/exp/slices"
+)
+
+// Functions reporting whether a file belongs to each named skip class.
+var skipClassMatchers = map[config.SkipClass]func(fileInfo types.FileInfo, exifTags types.ExifTags) bool{
+	config.SkipClassScreenshots: isScreenshot,
+}
+
+var screenshotNameRe = regexp.MustCompile(`(?i)^(screenshot|screen shot|screen_shot|scr_?\d)`)
+
+// Returns a description of the first skip rule in cfg matching the file described
+// by fileInfo, or an empty string if none match. Only rules that can be checked
+// before reading the file's contents are considered.
+func getFileSkipRule(cfg config.SkipConfig, fileInfo types.FileInfo) string {
+	if len(cfg.Include) > 0 {
+		included := false
+		for _, p := range cfg.Include {
+			if matchSkipPattern(p, fileInfo) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "include: no pattern matched"
+		}
+	}
+
+	for _, p := range cfg.Exclude {
+		if matchSkipPattern(p, fileInfo) {
+			return fmt.Sprintf("exclude: '%s'", p)
+		}
+	}
+
+	if cfg.MinSizeBytes > 0 && fileInfo.Size < cfg.MinSizeBytes {
+		return fmt.Sprintf("minSizeBytes: %d < %d", fileInfo.Size, cfg.MinSizeBytes)
+	}
+	if cfg.MaxSizeBytes > 0 && fileInfo.Size > cfg.MaxSizeBytes {
+		return fmt.Sprintf("maxSizeBytes: %d > %d", fileInfo.Size, cfg.MaxSizeBytes)
+	}
+
+	if len(cfg.MediaKinds) > 0 && !slices.Contains(cfg.MediaKinds, fileInfo.MediaKind) {
+		return fmt.Sprintf("mediaKinds: '%s' not in %v", fileInfo.MediaKind, cfg.MediaKinds)
+	}
+
+	return ""
+}
+
+// Returns a description of the first skip class in cfg matching the file described
+// by fileInfo and its exif tags, or an empty string if none match.
+func getClassSkipRule(cfg config.SkipConfig, fileInfo types.FileInfo, exifTags types.ExifTags) string {
+	for _, c := range cfg.Classes {
+		matcher, exists := skipClassMatchers[c]
+		if exists && matcher(fileInfo, exifTags) {
+			return fmt.Sprintf("classes: '%s'", c)
+		}
+	}
+
+	return ""
+}
+
+// Returns a description of the capture date skip rule in cfg matching date, or an
+// empty string if date is in range.
+func getDateSkipRule(cfg config.SkipConfig, date time.Time) string {
+	if !cfg.CapturedAfter.IsZero() && date.Before(cfg.CapturedAfter) {
+		return fmt.Sprintf("capturedAfter: %s", cfg.CapturedAfter.Format(time.RFC3339))
+	}
+	if !cfg.CapturedBefore.IsZero() && !date.Before(cfg.CapturedBefore) {
+		return fmt.Sprintf("capturedBefore: %s", cfg.CapturedBefore.Format(time.RFC3339))
+	}
+
+	return ""
+}
+
+func matchSkipPattern(pattern string, fileInfo types.FileInfo) bool {
+	target := filepath.Base(fileInfo.Path)
+	if strings.ContainsRune(pattern, '/') {
+		target = filepath.ToSlash(fileInfo.RelPath)
+	}
+
+	matched, _ := filepath.Match(pattern, target)
+	return matched
+}
+
+func isScreenshot(fileInfo types.FileInfo, exifTags types.ExifTags) bool {
+	if screenshotNameRe.MatchString(filepath.Base(fileInfo.Path)) {
+		return true
+	}
+
+	// iOS marks screenshots in the user comment tag.
+	return strings.EqualFold(exifTags.Misc["UserComment"].Value, "Screenshot")
+}
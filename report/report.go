@@ -0,0 +1,157 @@
+package report
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"porte/log"
+	"porte/utils"
+)
+
+//go:embed report.html.tmpl
+var reportTemplate string
+
+type reportData struct {
+	GeneratedAt string
+	Rows        <-chan row
+}
+
+type row struct {
+	Outcome        string
+	FileClass      string
+	SrcPath        string
+	DestPath       string
+	Ext            string
+	DateSrc        string
+	UsedDateTag    string
+	UsedDate       string
+	DateConfidence string
+	DatePrecision  string
+	DateCandidates []string
+	Geo            []string
+	SkipRule       string
+	Errors         []string
+	Thumb          template.URL
+}
+
+// Thumbnails larger than this aren't inlined, to keep the report small.
+const maxInlineThumbBytes = 8 << 10
+
+// Renders the streaming log at logFilePath into a self-contained html report at
+// destPath. Thumbnails found in thumbDir are inlined into the page.
+func Write(logFilePath string, thumbDir string, destPath string) error {
+	tmpl, err := template.New("report").Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	// Feed rows to the template as they are read, so the full log is never held
+	// in memory.
+
+	rows := make(chan row)
+	readErrCh := make(chan error, 1)
+	go func() {
+		defer close(rows)
+		readErrCh <- log.ReadRecords(logFilePath, func(record log.Record) error {
+			if record.Kind != log.RecordKindEntry || record.Entry == nil {
+				return nil
+			}
+			rows <- newRow(record.Entry.LogEntry, thumbDir)
+			return nil
+		})
+	}()
+
+	data := reportData{
+		GeneratedAt: time.Now().Format(time.RFC1123),
+		Rows:        rows,
+	}
+	err = tmpl.Execute(w, data)
+
+	// Drain any rows left unread after a template error, so the reader can finish.
+	for range rows {
+	}
+	if readErr := <-readErrCh; readErr != nil {
+		return readErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func newRow(e log.LogEntry, thumbDir string) row {
+	r := row{
+		Outcome:   string(e.Outcome),
+		FileClass: e.FileClass,
+		SrcPath:   e.SrcPath,
+		DestPath:  e.DestPath,
+		Ext:       strings.ToLower(filepath.Ext(e.SrcPath)),
+		DateSrc:   e.DateSrc,
+		SkipRule:  e.SkipRule,
+	}
+
+	for _, le := range e.Errors {
+		r.Errors = append(r.Errors, fmt.Sprintf("[%s] %s", le.Code, le.Message))
+	}
+
+	if !e.UsedDateTag.Date.IsZero() {
+		r.UsedDateTag = e.UsedDateTag.Name
+		r.UsedDate = e.UsedDateTag.Date.Format(utils.GoParseExifToolDateFmt)
+		r.DateConfidence = e.DateConfidence
+		r.DatePrecision = e.DateSrcFolderPrecision
+	}
+
+	for _, c := range e.DateCandidates {
+		desc := fmt.Sprintf("%s: %s", c.Src, c.Tag.Date.Format(utils.GoParseExifToolDateFmt))
+		if c.LostReason != "" {
+			desc += fmt.Sprintf(" (%s)", c.LostReason)
+		}
+		r.DateCandidates = append(r.DateCandidates, desc)
+	}
+
+	if e.UsedGeo != nil {
+		g := e.UsedGeo
+		r.Geo = append(r.Geo, fmt.Sprintf("%.6f, %.6f", g.Lat, g.Lon))
+		if g.HasAlt {
+			r.Geo = append(r.Geo, fmt.Sprintf("%.1f m", g.Alt))
+		}
+		r.Geo = append(r.Geo, fmt.Sprintf("from %s", g.Src))
+	}
+
+	for _, c := range e.GeoCandidates {
+		if c.LostReason == "" {
+			continue
+		}
+		desc := fmt.Sprintf("%s: %.6f, %.6f (%s", c.Loc.Src, c.Loc.Lat, c.Loc.Lon, c.LostReason)
+		if e.UsedGeo != nil {
+			desc += fmt.Sprintf(", %.1f km away", c.DistanceKm)
+		}
+		desc += ")"
+		if c.Conflict {
+			desc = "Conflict: " + desc
+		}
+		r.Geo = append(r.Geo, desc)
+	}
+
+	bt, err := os.ReadFile(utils.GetThumbPath(thumbDir, e.SrcPath))
+	if err == nil && len(bt) <= maxInlineThumbBytes {
+		r.Thumb = template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(bt))
+	}
+
+	return r
+}
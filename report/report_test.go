@@ -0,0 +1,70 @@
+package report
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"porte/log"
+	"porte/types"
+	"porte/utils"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	thumbDir := filepath.Join(dir, ".thumbs")
+	_ = os.MkdirAll(thumbDir, 0777)
+
+	logFilePath, err := log.Start(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []log.LogEntry{
+		{SrcPath: "/src/cats.jpg", Outcome: types.OutcomeSuccess, DateSrc: log.DateSrcExifTag},
+		{SrcPath: "/src/huge.png", Outcome: types.OutcomeSuccess, DateSrc: log.DateSrcExifTag},
+		{SrcPath: "/src/<script>.MOV", Outcome: types.OutcomeFail, FailReason: log.ErrCodeNoDate, Errors: []log.LogError{{Code: log.ErrCodeNoDate, Message: "No date"}}},
+	}
+	for _, e := range entries {
+		_ = log.AddEntry(e)
+	}
+	_ = os.WriteFile(utils.GetThumbPath(thumbDir, "/src/cats.jpg"), []byte("jpeg"), 0644)
+	_ = os.WriteFile(utils.GetThumbPath(thumbDir, "/src/huge.png"), []byte(strings.Repeat("x", maxInlineThumbBytes+1)), 0644)
+
+	_, err = log.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reportFilePath := filepath.Join(dir, "report.html")
+	err = Write(logFilePath, thumbDir, reportFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bt, err := os.ReadFile(reportFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(bt)
+
+	expecteds := []string{
+		`data-outcome="success" data-datesrc="exifTag" data-ext=".jpg"`,
+		`data-outcome="fail" data-datesrc="" data-ext=".mov"`,
+		`src="data:image/jpeg;base64,` + base64.StdEncoding.EncodeToString([]byte("jpeg")) + `"`,
+		`&lt;script&gt;`,
+	}
+	for _, expected := range expecteds {
+		if !strings.Contains(html, expected) {
+			t.Fatalf("Expected report to contain '%s'", expected)
+		}
+	}
+	if strings.Count(html, "data:image/jpeg;base64,") != 1 {
+		t.Fatalf("Expected only the thumbnail under %d bytes to be inlined", maxInlineThumbBytes)
+	}
+
+	fmt.Printf("Wrote %d bytes to '%s'\n", len(bt), reportFilePath)
+}
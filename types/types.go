@@ -12,12 +12,32 @@ const (
 	Unknown MediaKind = "unknown"
 )
 
+// How a scanned file relates to the export.
+type FileClass = string
+
+const (
+	// An image or video.
+	FileClassMedia FileClass = "media"
+	// A supplementary metadata file belonging to a media file.
+	FileClassMatchedMetadata FileClass = "matchedMetadata"
+	// A supplementary metadata file with no corresponding media file.
+	FileClassOrphanMetadata FileClass = "orphanMetadata"
+	// Any other file, including media that could not be read.
+	FileClassUnsupported FileClass = "unsupported"
+	// A dot-prefixed file, like .DS_Store, which is skipped.
+	FileClassHidden FileClass = "hidden"
+)
+
 type FileInfo struct {
-	Path      string
-	Name      string
-	MediaKind MediaKind
-	MIMEType  string
-	VidInfo   VidInfo
+	Path       string
+	RelPath    string
+	Name       string
+	Size       int64
+	MediaKind  MediaKind
+	FileClass  FileClass
+	MIMEType   string
+	VidInfo    VidInfo
+	AnalyzeErr string
 }
 
 // Map of file path to file info.
@@ -29,6 +49,47 @@ type ExifTags struct {
 	Misc  map[string]ExifStrTag
 	Dates map[string]ExifDateTag
 	Geo   map[string]ExifStrTag
+	// Google Photos' record of the location in the file when it was uploaded, which
+	// Geo may differ from if the location was edited there. Only set for
+	// supplementary files.
+	GeoExif map[string]ExifStrTag
+	// Names of the people shown, like Google Photos' people tags.
+	People []string
+	// States the file was in within Google Photos, like "favorited".
+	Flags []Flag
+}
+
+type Flag = string
+
+const (
+	FlagFavorited Flag = "favorited"
+	FlagArchived  Flag = "archived"
+	FlagTrashed   Flag = "trashed"
+)
+
+// A location in signed decimal degrees, with altitude in meters above sea level.
+type GeoLocation struct {
+	Lat    float64
+	Lon    float64
+	Alt    float64
+	HasAlt bool
+	// The horizontal positioning error in meters, or 0 if unknown.
+	PrecisionM float64
+	// Where the location was read from, like "exif" or "json:geoData".
+	Src string
+}
+
+// A location found for a file, and how it ranked against the others found.
+type GeoCandidate struct {
+	Loc GeoLocation
+	// The position of Loc.Src in the geo priority list, or -1 if it isn't listed.
+	Rank int
+	// Why the location wasn't used. Empty for the location that was used.
+	LostReason string
+	// The distance in kilometers from the location that was used.
+	DistanceKm float64
+	// Whether DistanceKm is over the conflict threshold.
+	Conflict bool
 }
 
 type ExifStrTag struct {
@@ -39,17 +100,104 @@ type ExifStrTag struct {
 type ExifDateTag struct {
 	Name string
 	Date time.Time
+	// Whether Date is a known instant, rather than a wall-clock time in an unknown
+	// time zone (which is stored as if it were UTC).
+	HasZone bool
+}
+
+// A date that could be used as a file's capture date.
+type DateCandidate struct {
+	// The source of the date, like "exif:DateTimeOriginal", "json:photoTakenTime",
+	// or "filename".
+	Src string
+	Tag ExifDateTag
+	// The position of Src in the date priority list, or -1 if it isn't listed.
+	Rank int
+	// Why the date wasn't used. Empty for the date that was used.
+	LostReason string
+	// How reliable an estimated date is. Empty for dates read from a source.
+	Confidence DateConfidence
+	// How precisely a date parsed from a string is known, like "year" for a folder
+	// named "Photos from 2014". Empty for dates read from a tag.
+	Precision string
 }
 
+type DateConfidence = string
+
+const (
+	DateConfidenceHigh   DateConfidence = "high"
+	DateConfidenceMedium DateConfidence = "medium"
+	DateConfidenceLow    DateConfidence = "low"
+)
+
 type VidInfo struct {
-	VidCodec             string
-	IsVidCompat          bool
-	AudCodec             string
+	// The codec of the first video stream.
+	VidCodec string
+	// Whether every video stream can be copied into an mp4 container as is.
+	IsVidCompat bool
+	// The codec of the first audio stream.
+	AudCodec string
+	// Whether every audio stream can be copied into an mp4 container as is.
 	IsAudCompat          bool
 	CanBeRePackagedInMP4 bool
-	DurationSec          float64
+	// How each stream is handled when repackaging in an mp4 container.
+	StreamDecisions []StreamDecision
+	DurationSec     float64
+	// The container format, as named by ffprobe, like "mov,mp4,m4a,3gp,3g2,mj2".
+	FormatName string
+	// The overall bitrate in bits per second, or 0 if unknown.
+	BitRate int64
+	// The container's creation_time tag, if set.
+	CreationTime time.Time
+	// The clockwise rotation in degrees of the first video stream's display.
+	Rotation int
+	Streams  []VidStream
+}
+
+// A stream in a video file, as reported by ffprobe.
+type VidStream struct {
+	Index int
+	// "video", "audio", "subtitle", or "data".
+	Type  string
+	Codec string
+	// The frame size of a video stream.
+	Width  int
+	Height int
+	// The clockwise rotation in degrees of a video stream's display.
+	Rotation int
+	// The bitrate in bits per second, or 0 if unknown.
+	BitRate  int64
+	Language string
+	// Whether the stream is a still image, like cover art, rather than video.
+	IsAttachedPic bool
 }
 
+// How a video's stream is handled when repackaging it, and why.
+type StreamDecision struct {
+	// The index of the stream in the file.
+	Index int
+	// "video", "audio", "subtitle", or "data".
+	Stream string
+	Codec  string
+	Action StreamAction
+	Reason string
+}
+
+type StreamAction = string
+
+const (
+	// Copy the stream as is.
+	StreamActionCopy StreamAction = "copy"
+	// Copy the stream as is, with the hvc1 tag that Apple players require for HEVC.
+	StreamActionCopyHvc1 StreamAction = "copyHvc1"
+	// Re-encode just this stream, as AAC audio or mov_text subtitles.
+	StreamActionTranscode StreamAction = "transcode"
+	// Leave the stream out, like a data stream or cover art.
+	StreamActionDrop StreamAction = "drop"
+	// The stream can't be repackaged, so neither can the file.
+	StreamActionUnsupported StreamAction = "unsupported"
+)
+
 // Results.
 
 type Outcome string
@@ -58,6 +206,8 @@ const (
 	OutcomeSuccess Outcome = "success"
 	OutcomeFail    Outcome = "fail"
 	OutcomeSkip    Outcome = "skip"
+	// The file is not media; see its FileClass.
+	OutcomeOther Outcome = "other"
 )
 
 // Map of file extension to occurrence count.
@@ -0,0 +1,71 @@
+package tz
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ringsaturn/tzf"
+
+	// Bundle the time zone database, so zones resolve on systems without one.
+	_ "time/tzdata"
+)
+
+const earthRadiusKm = 6371
+
+var (
+	finderOnce sync.Once
+	finder     tzf.F
+	finderErr  error
+)
+
+// Returns the time zone containing the point at lat, lon (in signed decimal
+// degrees), resolved offline from the bundled timezone-boundary-builder shapes,
+// which include territorial waters and nautical zones at sea.
+func Lookup(lat float64, lon float64) (*time.Location, error) {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("coordinates %f, %f are out of range", lat, lon)
+	}
+
+	// Decoding the shapes takes about a second, so only do it once it's needed.
+	finderOnce.Do(func() {
+		finder, finderErr = tzf.NewDefaultFinder()
+	})
+	if finderErr != nil {
+		return nil, fmt.Errorf("error loading time zone boundaries: %s", finderErr)
+	}
+
+	name := finder.GetTimezoneName(lon, lat)
+	if name == "" {
+		name = nauticalZoneName(lon)
+	}
+
+	return time.LoadLocation(name)
+}
+
+// Returns the great-circle distance in kilometers between two points given in
+// signed decimal degrees.
+func DistanceKm(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Returns the Etc zone for the 15-degree band of longitude containing lon, for
+// points outside every boundary. Note that Etc zone names use inverted signs, so
+// Etc/GMT+5 is five hours behind UTC.
+func nauticalZoneName(lon float64) string {
+	offset := int(math.Round(lon / 15))
+	if offset == 0 {
+		return "Etc/GMT"
+	}
+	if offset > 12 {
+		offset = 12
+	}
+	return fmt.Sprintf("Etc/GMT%+d", -offset)
+}
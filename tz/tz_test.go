@@ -0,0 +1,45 @@
+package tz
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	type Iter struct {
+		lat          float64
+		lon          float64
+		expectedZone string
+	}
+
+	var iters = []Iter{
+		{lat: 35.6586, lon: 139.7454, expectedZone: "Asia/Tokyo"},
+		{lat: 40.694694, lon: -73.950997, expectedZone: "America/New_York"},
+		{lat: -33.8568, lon: 151.2153, expectedZone: "Australia/Sydney"},
+		{lat: 48.8584, lon: 2.2945, expectedZone: "Europe/Paris"},
+		{lat: -22.9519, lon: -43.2105, expectedZone: "America/Sao_Paulo"},
+		{lat: 35, lon: -150, expectedZone: "Etc/GMT+10"},
+		// Near zone boundaries.
+		{lat: 36.1627, lon: -86.7816, expectedZone: "America/Chicago"},              // Nashville
+		{lat: 37.0842, lon: -94.5133, expectedZone: "America/Chicago"},              // Joplin, MO
+		{lat: 46.8139, lon: -71.2080, expectedZone: "America/Toronto"},              // Quebec City
+		{lat: 44.8016, lon: -68.7712, expectedZone: "America/New_York"},             // Bangor, ME
+		{lat: 48.3809, lon: -89.2477, expectedZone: "America/Toronto"},              // Thunder Bay
+		{lat: 41.6764, lon: -86.2520, expectedZone: "America/Indiana/Indianapolis"}, // South Bend
+		{lat: 41.6005, lon: -87.3429, expectedZone: "America/Chicago"},              // Gary, IN
+		{lat: 47.5596, lon: 7.5886, expectedZone: "Europe/Zurich"},                  // Basel
+		{lat: 47.5897, lon: 7.5597, expectedZone: "Europe/Paris"},                   // Saint-Louis, across the border
+	}
+
+	for _, iter := range iters {
+		loc, err := Lookup(iter.lat, iter.lon)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.String() != iter.expectedZone {
+			t.Fatalf("For %f, %f, expected zone %s but got %s", iter.lat, iter.lon, iter.expectedZone, loc)
+		}
+
+		fmt.Printf("Found zone %s for %f, %f\n", loc, iter.lat, iter.lon)
+	}
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How much of a date parsed from a string is known, like "second" for a date from
+// IMG_20190712_183455.
+type DatePrecision = string
+
+const (
+	DatePrecisionMillisecond DatePrecision = "millisecond"
+	DatePrecisionSecond      DatePrecision = "second"
+	DatePrecisionTime        DatePrecision = "time"
+	DatePrecisionDay         DatePrecision = "day"
+	DatePrecisionMonth       DatePrecision = "month"
+	DatePrecisionYear        DatePrecision = "year"
+)
+
+// A date found in a string, like a file name.
+type StrDate struct {
+	Date time.Time
+	// The name of the pattern that matched, or "dateparser" for a free-form date.
+	Pattern   string
+	Precision DatePrecision
+	// The part of the string the date was parsed from.
+	Match string
+	// The language the date was parsed in, for a free-form date.
+	Language string
+}
+
+const StrDatePatternDateparser = "dateparser"
+
+// A file naming format with a known date layout. The expression names its groups
+// y, mo, d, h, mi, s, and ms; any omitted group is taken as zero.
+type nameDatePattern struct {
+	Name      string
+	Re        *regexp.Regexp
+	Precision DatePrecision
+}
+
+// Naming formats of common phones, apps, and cameras, from most to least specific.
+// Prefixes are matched regardless of case, since some tools lower-case names when
+// copying files.
+var nameDatePatterns = []nameDatePattern{
+	{
+		// PXL_20230101_120000123
+		Name:      "pixel",
+		Re:        regexp.MustCompile(`(?i)PXL_(?P<y>\d{4})(?P<mo>\d{2})(?P<d>\d{2})_(?P<h>\d{2})(?P<mi>\d{2})(?P<s>\d{2})(?P<ms>\d{3})`),
+		Precision: DatePrecisionMillisecond,
+	},
+	{
+		// IMG_20190712_183455, VID_20190712_183455, PANO_20190712_183455
+		Name:      "android",
+		Re:        regexp.MustCompile(`(?i)(?:IMG|VID|PANO|MVIMG|BURST\d*)_(?P<y>\d{4})(?P<mo>\d{2})(?P<d>\d{2})_(?P<h>\d{2})(?P<mi>\d{2})(?P<s>\d{2})`),
+		Precision: DatePrecisionSecond,
+	},
+	{
+		// Screenshot_2020-05-01-10-22-33, Screenshot_20200501-102233
+		Name:      "androidScreenshot",
+		Re:        regexp.MustCompile(`(?i)Screenshot_(?P<y>\d{4})-?(?P<mo>\d{2})-?(?P<d>\d{2})-(?P<h>\d{2})-?(?P<mi>\d{2})-?(?P<s>\d{2})`),
+		Precision: DatePrecisionSecond,
+	},
+	{
+		// Screenshot 2020-05-01 at 10.22.33, Screen Shot 2020-05-01 at 9.22.33
+		Name:      "macScreenshot",
+		Re:        regexp.MustCompile(`(?i)Screen ?shot (?P<y>\d{4})-(?P<mo>\d{2})-(?P<d>\d{2}) at (?P<h>\d{1,2})\.(?P<mi>\d{2})\.(?P<s>\d{2})`),
+		Precision: DatePrecisionSecond,
+	},
+	{
+		// signal-2021-03-04-101010
+		Name:      "signal",
+		Re:        regexp.MustCompile(`(?i)signal-(?P<y>\d{4})-(?P<mo>\d{2})-(?P<d>\d{2})-(?P<h>\d{2})(?P<mi>\d{2})(?P<s>\d{2})`),
+		Precision: DatePrecisionSecond,
+	},
+	{
+		// VID-20180305-WA0003, IMG-20180305-WA0003
+		Name:      "whatsapp",
+		Re:        regexp.MustCompile(`(?i)(?:IMG|VID|AUD|PTT|STK)-(?P<y>\d{4})(?P<mo>\d{2})(?P<d>\d{2})-WA\d+`),
+		Precision: DatePrecisionDay,
+	},
+	{
+		// DJI_20230101120000_0001
+		Name:      "dji",
+		Re:        regexp.MustCompile(`(?i)DJI_(?P<y>\d{4})(?P<mo>\d{2})(?P<d>\d{2})(?P<h>\d{2})(?P<mi>\d{2})(?P<s>\d{2})_`),
+		Precision: DatePrecisionSecond,
+	},
+	{
+		// 20190712_183455, as named by Samsung cameras
+		Name:      "samsung",
+		Re:        regexp.MustCompile(`^(?P<y>\d{4})(?P<mo>\d{2})(?P<d>\d{2})_(?P<h>\d{2})(?P<mi>\d{2})(?P<s>\d{2})`),
+		Precision: DatePrecisionSecond,
+	},
+}
+
+// Returns the date in s matching a known naming format, if any.
+func getDateFromNamePattern(s string) (StrDate, bool) {
+	for _, p := range nameDatePatterns {
+		match := p.Re.FindStringSubmatch(s)
+		if match == nil {
+			continue
+		}
+
+		parts := map[string]int{}
+		for i, name := range p.Re.SubexpNames() {
+			if name == "" || match[i] == "" {
+				continue
+			}
+			n, err := strconv.Atoi(match[i])
+			if err != nil {
+				continue
+			}
+			parts[name] = n
+		}
+
+		date := time.Date(parts["y"], time.Month(parts["mo"]), parts["d"], parts["h"], parts["mi"], parts["s"], parts["ms"]*int(time.Millisecond), time.UTC)
+
+		// Reject impossible values, which time.Date would otherwise normalize.
+		if date.Year() != parts["y"] || int(date.Month()) != parts["mo"] || date.Day() != parts["d"] ||
+			date.Hour() != parts["h"] || date.Minute() != parts["mi"] || date.Second() != parts["s"] {
+			continue
+		}
+
+		return StrDate{
+			Date:      date,
+			Pattern:   p.Name,
+			Precision: p.Precision,
+			Match:     match[0],
+		}, true
+	}
+
+	return StrDate{}, false
+}
+
+// Matches a year and month in a folder name, like "2009-07 Lisbon trip".
+var folderMonthRe = regexp.MustCompile(`(?:^|\D)((?:18|19|20)\d{2})[-_. ](0[1-9]|1[0-2])(?:\D|$)`)
+
+// Matches a year in a folder name, like "Photos from 2014".
+var folderYearRe = regexp.MustCompile(`(?:^|\D)((?:18|19|20)\d{2})(?:\D|$)`)
+
+// Returns the start of the month or year named by the innermost folder in relDir
+// that names one, like "2009-07 Lisbon trip" or "Photos from 2014".
+func GetDateFromFolders(relDir string) (StrDate, error) {
+	dirs := strings.Split(filepath.ToSlash(relDir), "/")
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+
+		match := folderMonthRe.FindStringSubmatch(dir)
+		if match != nil {
+			year, _ := strconv.Atoi(match[1])
+			month, _ := strconv.Atoi(match[2])
+			return StrDate{
+				Date:      time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC),
+				Pattern:   "folder",
+				Precision: DatePrecisionMonth,
+				Match:     dir,
+			}, nil
+		}
+
+		match = folderYearRe.FindStringSubmatch(dir)
+		if match != nil {
+			year, _ := strconv.Atoi(match[1])
+			return StrDate{
+				Date:      time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Pattern:   "folder",
+				Precision: DatePrecisionYear,
+				Match:     dir,
+			}, nil
+		}
+	}
+
+	return StrDate{}, fmt.Errorf("no dates found in folders '%s'", relDir)
+}
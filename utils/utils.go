@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,6 +14,7 @@ import (
 	"porte/types"
 
 	"github.com/markusmobius/go-dateparser"
+	"github.com/markusmobius/go-dateparser/date"
 )
 
 const (
@@ -26,10 +29,31 @@ const (
 
 	// The Go format for parsing date values from exiftool queries.
 	GoParseExifToolDateFmt = "2006-01-02T15:04:05"
+
+	// The Go formats for parsing raw date values from exiftool, from most to least
+	// precise. Fractional seconds are accepted after the seconds field.
+	goParseExifDateFmtZone = "2006:01:02 15:04:05Z07:00"
+	goParseExifDateFmt     = "2006:01:02 15:04:05"
+
+	// The Go format for exif offset tags, like OffsetTimeOriginal.
+	GoOffsetFmt = "-07:00"
 )
 
+// Returns the path in thumbDir where the thumbnail for the file at srcPath is
+// stored.
+func GetThumbPath(thumbDir string, srcPath string) string {
+	sum := sha1.Sum([]byte(srcPath))
+	return filepath.Join(thumbDir, hex.EncodeToString(sum[:])+".jpg")
+}
+
 // Finds an available path in destDir, trying incrementing suffixes if needed.
 func GetAvailableDestPath(destDir string, destFileName string) (destPath string) {
+	return GetAvailableDestPathWithSidecar(destDir, destFileName, nil)
+}
+
+// Finds an available path in destDir like GetAvailableDestPath, which also leaves
+// the path returned by sidecarPath for it available, if sidecarPath isn't nil.
+func GetAvailableDestPathWithSidecar(destDir string, destFileName string, sidecarPath func(path string) string) (destPath string) {
 	base := filepath.Base(destFileName)
 	ext := filepath.Ext(destFileName)
 	name := strings.TrimSuffix(base, ext)
@@ -42,9 +66,16 @@ func GetAvailableDestPath(destDir string, destFileName string) (destPath string)
 			destName = fmt.Sprintf("%s%s%d%s", name, FileNamePartSep, incr, ext)
 		}
 
-		_, err := os.Stat(filepath.Join(destDir, destName))
+		path := filepath.Join(destDir, destName)
+		_, err := os.Stat(path)
+		if err != nil && sidecarPath != nil {
+			_, sidecarErr := os.Stat(sidecarPath(path))
+			if sidecarErr == nil {
+				err = nil
+			}
+		}
 		if err != nil {
-			destPath = filepath.Join(destDir, destName)
+			destPath = path
 		}
 
 		incr++
@@ -71,8 +102,11 @@ func GetSupplementaryFilePath(srcPath string, supplFileInfoMap types.FileInfoMap
 	return "", fmt.Errorf("no file at '%s'", fullPath)
 }
 
-// Parses s and returns a date, if one is represented.
-func GetDateFromStr(s string) (date time.Time, err error) {
+// Parses s and returns a date, if one is represented. Known naming formats, like
+// IMG_20190712_183455, are tried first, falling back to a free-form search in each
+// of languages (like "en" or "fr"). The most precise free-form date wins, with ties
+// going to the earlier language.
+func GetDateFromStr(s string, languages []string) (result StrDate, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("panic when checking for date in '%s': %s", s, r)
@@ -83,25 +117,100 @@ func GetDateFromStr(s string) (date time.Time, err error) {
 	ext := filepath.Ext(s)
 	s = strings.TrimSuffix(s, ext)
 
+	result, ok := getDateFromNamePattern(s)
+	if ok {
+		return result, nil
+	}
+
 	// Check if a date might be incorrectly found in an arbitrary number string.
 	re := regexp.MustCompile(`\d{9}`)
 	exists := re.MatchString(s)
 	if exists {
-		return time.Time{}, fmt.Errorf("'%s' contains a long numeric string which probably does not represent a date", s)
+		return StrDate{}, fmt.Errorf("'%s' contains a long numeric string which probably does not represent a date", s)
 	}
 
-	// Search the string for a date.
+	// Search the string for a date in each language.
 	parser := dateparser.Parser{}
-	dates, err := parser.SearchWithLanguage(nil, "en", s)
-	if err != nil {
-		return time.Time{}, err
+	var best *dateparser.SearchResult
+	for _, lang := range languages {
+		dates, err := parser.SearchWithLanguage(nil, lang, s)
+		if err != nil {
+			return StrDate{}, err
+		}
+		if len(dates) == 0 || dates[0].Date.IsZero() {
+			continue
+		}
+
+		// A lower period is more precise.
+		if best == nil || dates[0].Date.Period < best.Date.Period {
+			best = &dates[0]
+		}
 	}
 
-	if len(dates) == 0 {
-		return time.Time{}, fmt.Errorf("no dates found in '%s'", s)
+	if best == nil {
+		return StrDate{}, fmt.Errorf("no dates found in '%s'", s)
 	}
-	d := dates[0]
-	return d.Date.Time, nil
+	return StrDate{
+		Date:      best.Date.Time,
+		Pattern:   StrDatePatternDateparser,
+		Precision: getDateparserPrecision(best.Date.Period),
+		Match:     best.Text,
+		Language:  best.Date.Locale,
+	}, nil
+}
+
+// Returns whether lang is a language code supported for free-form date searches.
+func IsDateLanguage(lang string) bool {
+	parser := dateparser.Parser{}
+	_, err := parser.SearchWithLanguage(nil, lang, "")
+	return err == nil
+}
+
+func getDateparserPrecision(p date.Period) DatePrecision {
+	switch p {
+	case date.Time:
+		return DatePrecisionTime
+	case date.Month:
+		return DatePrecisionMonth
+	case date.Year:
+		return DatePrecisionYear
+	default:
+		return DatePrecisionDay
+	}
+}
+
+// Parses a raw date value from exiftool, like "2015:11:07 18:41:26.123-05:00".
+// Returns whether the value included a zone; if not, the date is stored as UTC.
+func ParseExifDate(v string) (date time.Time, hasZone bool, err error) {
+	v = strings.TrimSpace(v)
+
+	date, err = time.Parse(goParseExifDateFmtZone, v)
+	if err == nil {
+		return date, true, nil
+	}
+
+	date, err = time.Parse(goParseExifDateFmt, v)
+	if err == nil {
+		return date, false, nil
+	}
+
+	return time.Time{}, false, fmt.Errorf("'%s' is not a valid date", v)
+}
+
+// Parses an exif offset value, like "+09:00", into a fixed time zone.
+func ParseExifOffset(v string) (*time.Location, error) {
+	t, err := time.Parse(GoOffsetFmt, strings.TrimSpace(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Location(), nil
+}
+
+// Returns the same wall-clock time as date, in loc. This places a date read
+// without a time zone (and so stored as UTC) into its actual zone.
+func WallClockIn(date time.Time, loc *time.Location) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), loc)
 }
 
 // Returns a comma-separated list from the provided map, ordered by each
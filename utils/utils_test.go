@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"porte/types"
 )
@@ -49,7 +50,7 @@ func TestGetDateFromStr(t *testing.T) {
 	for _, iter := range iters {
 		foundDate := false
 
-		d, err := GetDateFromStr(iter.str)
+		d, err := GetDateFromStr(iter.str, []string{"en"})
 		if err != nil {
 			foundDate = false
 		}
@@ -59,3 +60,147 @@ func TestGetDateFromStr(t *testing.T) {
 		}
 	}
 }
+
+func TestGetDateFromStrPatterns(t *testing.T) {
+	type Iter struct {
+		str               string
+		expectedDate      string
+		expectedPattern   string
+		expectedPrecision DatePrecision
+	}
+
+	var iters = []Iter{
+		{str: "IMG_20190712_183455.jpg", expectedDate: "2019-07-12T18:34:55Z", expectedPattern: "android", expectedPrecision: DatePrecisionSecond},
+		{str: "PXL_20230101_120000123.jpg", expectedDate: "2023-01-01T12:00:00.123Z", expectedPattern: "pixel", expectedPrecision: DatePrecisionMillisecond},
+		{str: "VID-20180305-WA0003.mp4", expectedDate: "2018-03-05T00:00:00Z", expectedPattern: "whatsapp", expectedPrecision: DatePrecisionDay},
+		{str: "Screenshot_2020-05-01-10-22-33.png", expectedDate: "2020-05-01T10:22:33Z", expectedPattern: "androidScreenshot", expectedPrecision: DatePrecisionSecond},
+		{str: "signal-2021-03-04-101010.jpg", expectedDate: "2021-03-04T10:10:10Z", expectedPattern: "signal", expectedPrecision: DatePrecisionSecond},
+		{str: "Screenshot 2020-05-01 at 10.22.33.jpg", expectedDate: "2020-05-01T10:22:33Z", expectedPattern: "macScreenshot", expectedPrecision: DatePrecisionSecond},
+		{str: "img_20190712_183455.jpg", expectedDate: "2019-07-12T18:34:55Z", expectedPattern: "android", expectedPrecision: DatePrecisionSecond},
+		{str: "pxl_20230101_120000123.jpg", expectedDate: "2023-01-01T12:00:00.123Z", expectedPattern: "pixel", expectedPrecision: DatePrecisionMillisecond},
+		{str: "vid-20180305-wa0003.mp4", expectedDate: "2018-03-05T00:00:00Z", expectedPattern: "whatsapp", expectedPrecision: DatePrecisionDay},
+		{str: "screenshot_2020-05-01-10-22-33.png", expectedDate: "2020-05-01T10:22:33Z", expectedPattern: "androidScreenshot", expectedPrecision: DatePrecisionSecond},
+		{str: "Signal-2021-03-04-101010.jpg", expectedDate: "2021-03-04T10:10:10Z", expectedPattern: "signal", expectedPrecision: DatePrecisionSecond},
+		{str: "dji_20230101120000_0001.mp4", expectedDate: "2023-01-01T12:00:00Z", expectedPattern: "dji", expectedPrecision: DatePrecisionSecond},
+		{str: "screen shot 2020-05-01 at 9.22.33.png", expectedDate: "2020-05-01T09:22:33Z", expectedPattern: "macScreenshot", expectedPrecision: DatePrecisionSecond},
+		{str: "IMG_20191332_183455.jpg", expectedDate: "", expectedPattern: "", expectedPrecision: ""},
+	}
+
+	for _, iter := range iters {
+		d, err := GetDateFromStr(iter.str, []string{"en"})
+		if iter.expectedDate == "" {
+			if err == nil && d.Pattern != StrDatePatternDateparser {
+				t.Fatalf("Expected no pattern to match '%s', but got '%s'", iter.str, d.Pattern)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actualDate := d.Date.Format(time.RFC3339Nano)
+		if actualDate != iter.expectedDate || d.Pattern != iter.expectedPattern || d.Precision != iter.expectedPrecision {
+			t.Fatalf("Expected '%s' (%s, %s) from '%s', but got '%s' (%s, %s)", iter.expectedDate, iter.expectedPattern, iter.expectedPrecision, iter.str, actualDate, d.Pattern, d.Precision)
+		}
+
+		fmt.Printf("Found date '%s' in string '%s' matching '%s'\n", actualDate, iter.str, d.Match)
+	}
+}
+
+func TestGetDateFromStrLanguages(t *testing.T) {
+	type Iter struct {
+		str              string
+		languages        []string
+		expectedDate     string
+		expectedLanguage string
+	}
+
+	var iters = []Iter{
+		{str: "12 février 2012 Lynx.jpg", languages: []string{"en", "fr"}, expectedDate: "2012-02-12", expectedLanguage: "fr"},
+		{str: "Weihnachten 24. Dezember 2009.jpg", languages: []string{"en", "de"}, expectedDate: "2009-12-24", expectedLanguage: "de"},
+		{str: "june-5-2012.jpg", languages: []string{"en", "de"}, expectedDate: "2012-06-05", expectedLanguage: "en"},
+	}
+
+	for _, iter := range iters {
+		d, err := GetDateFromStr(iter.str, iter.languages)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actualDate := d.Date.Format("2006-01-02")
+		if actualDate != iter.expectedDate || d.Language != iter.expectedLanguage {
+			t.Fatalf("Expected '%s' in '%s' from '%s', but got '%s' in '%s'", iter.expectedDate, iter.expectedLanguage, iter.str, actualDate, d.Language)
+		}
+
+		fmt.Printf("Found date '%s' in string '%s' matching '%s' in '%s'\n", actualDate, iter.str, d.Match, d.Language)
+	}
+}
+
+func TestGetDateFromFolders(t *testing.T) {
+	type Iter struct {
+		relDir            string
+		expectedDate      string
+		expectedPrecision DatePrecision
+	}
+
+	var iters = []Iter{
+		{relDir: "Takeout/Google Photos/Photos from 2014", expectedDate: "2014-01-01", expectedPrecision: DatePrecisionYear},
+		{relDir: "Albums/2009-07 Lisbon trip", expectedDate: "2009-07-01", expectedPrecision: DatePrecisionMonth},
+		{relDir: "2008/Summer", expectedDate: "2008-01-01", expectedPrecision: DatePrecisionYear},
+		{relDir: "Albums/Lisbon trip", expectedDate: "", expectedPrecision: ""},
+	}
+
+	for _, iter := range iters {
+		d, err := GetDateFromFolders(iter.relDir)
+		if iter.expectedDate == "" {
+			if err == nil {
+				t.Fatalf("Expected no date in '%s', but got '%s'", iter.relDir, d.Date)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actualDate := d.Date.Format("2006-01-02")
+		if actualDate != iter.expectedDate || d.Precision != iter.expectedPrecision {
+			t.Fatalf("Expected '%s' (%s) from '%s', but got '%s' (%s)", iter.expectedDate, iter.expectedPrecision, iter.relDir, actualDate, d.Precision)
+		}
+
+		fmt.Printf("Found date '%s' in folder '%s'\n", actualDate, d.Match)
+	}
+}
+
+func TestParseExifDate(t *testing.T) {
+	type Iter struct {
+		str             string
+		expectedUTC     string
+		expectedHasZone bool
+	}
+
+	var iters = []Iter{
+		{str: "2015:11:07 18:41:26", expectedUTC: "2015-11-07T18:41:26Z", expectedHasZone: false},
+		{str: "2015:11:07 18:41:26-05:00", expectedUTC: "2015-11-07T23:41:26Z", expectedHasZone: true},
+		{str: "2015:11:07 18:41:26.123+09:00", expectedUTC: "2015-11-07T09:41:26Z", expectedHasZone: true},
+		{str: "2015:11:07 18:41:26Z", expectedUTC: "2015-11-07T18:41:26Z", expectedHasZone: true},
+	}
+
+	for _, iter := range iters {
+		d, hasZone, err := ParseExifDate(iter.str)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actualUTC := d.UTC().Truncate(time.Second).Format(time.RFC3339)
+		if actualUTC != iter.expectedUTC || hasZone != iter.expectedHasZone {
+			t.Fatalf("For '%s', expected %s (zone: %t) but got %s (zone: %t)", iter.str, iter.expectedUTC, iter.expectedHasZone, actualUTC, hasZone)
+		}
+
+		fmt.Printf("Parsed '%s' as %s\n", iter.str, d)
+	}
+
+	_, _, err := ParseExifDate("0000:00:00 00:00:00")
+	if err == nil {
+		t.Fatal("Expected an error for an empty date")
+	}
+}